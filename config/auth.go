@@ -0,0 +1,263 @@
+package config
+
+import (
+	"net"
+	"os"
+	"time"
+)
+
+// RegistrationMode decides who may create an account through /api/register
+type RegistrationMode string
+
+const (
+	// RegistrationOpen lets anyone register
+	RegistrationOpen RegistrationMode = "open"
+	// RegistrationInvite requires an invite code from an existing user
+	RegistrationInvite RegistrationMode = "invite"
+	// RegistrationApproval keeps new accounts pending until an admin approves them
+	RegistrationApproval RegistrationMode = "approval"
+)
+
+// Valid reports whether m is one of the known modes
+func (m RegistrationMode) Valid() bool {
+	switch m {
+	case RegistrationOpen, RegistrationInvite, RegistrationApproval:
+		return true
+	}
+	return false
+}
+
+// AuthConfig holds the token lifetimes and signing keys used by the auth handlers
+type AuthConfig struct {
+	// JWTKeysDir holds "<kid>.pem" and "<kid>.secret" files, see utils.LoadKeySet
+	JWTKeysDir     string
+	JWTSecret      string
+	JWTActiveKeyID string
+	JWTIssuer      string
+	JWTAudience    string
+	// JWTClockSkew is the leeway allowed when checking exp, nbf and iat
+	JWTClockSkew time.Duration
+	// JWTEphemeralKey lets the server start without keys, signing with a
+	// throwaway one. It is meant for development only.
+	JWTEphemeralKey bool
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// RevocationCacheTTL bounds how long another instance's logout can go unnoticed
+	RevocationCacheTTL      time.Duration
+	RevocationPruneInterval time.Duration
+
+	// RequireEmailVerification blocks login until the address has been confirmed.
+	// It is on by default only when emails are actually delivered over SMTP.
+	RequireEmailVerification bool
+	EmailVerificationTTL     time.Duration
+	PasswordResetTTL         time.Duration
+
+	// TwoFactorChallengeTTL is how long a client has to enter its TOTP code after the password
+	TwoFactorChallengeTTL time.Duration
+	TOTPIssuer            string
+
+	// WebAuthnRPID is the relying party ID passkeys are bound to, normally the site's domain
+	WebAuthnRPID   string
+	WebAuthnRPName string
+	// WebAuthnOrigins lists the origins browsers may run the ceremonies from
+	WebAuthnOrigins []string
+	WebAuthnTimeout time.Duration
+
+	// MagicLinkEnabled allows signing in with a one-time link sent by email
+	MagicLinkEnabled bool
+	MagicLinkTTL     time.Duration
+
+	// Failed logins allowed per account and per client IP within LoginFailureWindow
+	// before lockouts start. Each further failure doubles the lockout, starting at
+	// LoginLockoutBase and capped at LoginLockoutMax.
+	LoginMaxAccountFailures int
+	LoginMaxIPFailures      int
+	LoginFailureWindow      time.Duration
+	LoginLockoutBase        time.Duration
+	LoginLockoutMax         time.Duration
+
+	// Emails the unauthenticated endpoints send to one address, and requests
+	// they take from one client IP, within LoginFailureWindow before the same
+	// lockouts start
+	EmailMaxAddressRequests int
+	EmailMaxIPRequests      int
+
+	// Lifetimes of personal access tokens when none is requested, and at most
+	PersonalAccessTokenTTL    time.Duration
+	PersonalAccessTokenMaxTTL time.Duration
+
+	// PasswordHashAlgorithm is "bcrypt" or "argon2id". Stored hashes made with
+	// another algorithm or weaker parameters are upgraded on the next login.
+	PasswordHashAlgorithm string
+	BcryptCost            int
+	Argon2Time            int
+	Argon2MemoryKiB       int
+	Argon2Threads         int
+
+	// Rules new passwords must satisfy. Lengths count characters, and
+	// PasswordMinStrength is a zxcvbn-style score from 0 (no check) to 4.
+	PasswordMinLength        int
+	PasswordMaxLength        int
+	PasswordRequireUppercase bool
+	PasswordRequireLowercase bool
+	PasswordRequireDigit     bool
+	PasswordRequireSymbol    bool
+	PasswordMinStrength      int
+	// PasswordBreachedList is a file or directory of SHA-1 hashes of leaked
+	// passwords, see utils.LoadBreachedPasswords. Empty disables the check.
+	PasswordBreachedList string
+
+	// AccountDeletionGracePeriod is how long a deleted account can still be
+	// restored by an admin before it is purged
+	AccountDeletionGracePeriod time.Duration
+
+	RegistrationMode RegistrationMode
+	// Lifetimes of invites when none is requested, and at most, and the most
+	// registrations one invite may allow
+	InviteTTL     time.Duration
+	InviteMaxTTL  time.Duration
+	InviteMaxUses int
+
+	// OIDCIssuer is the identity provider used for single sign-on; leaving it
+	// or OIDCClientID empty turns single sign-on off
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	// OIDCRedirectURL is the front-end page the provider sends the browser back to
+	OIDCRedirectURL string
+	OIDCScopes      []string
+	// OIDCAutoProvision creates an account on the first login of an unknown user
+	OIDCAutoProvision bool
+	// OIDCLoginTTL is how long a client has to come back from the provider
+	OIDCLoginTTL time.Duration
+
+	// SessionCookies lets browser front-ends ask, with SessionModeHeader set to
+	// "cookie", for HttpOnly cookies instead of tokens in the response. Unsafe
+	// requests authenticated by the cookie must repeat the value of the CSRF
+	// cookie in CSRFHeader.
+	SessionCookies    bool
+	SessionModeHeader string
+	SessionCookieName string
+	RefreshCookieName string
+	CSRFCookieName    string
+	CSRFHeader        string
+	CookieDomain      string
+	// CookieSecure should only be turned off for local development over http
+	CookieSecure bool
+	// CookieSameSite is "lax", "strict" or "none"
+	CookieSameSite string
+
+	// ProxyAuthTrustedProxies are the reverse proxies whose ProxyAuthUserHeader
+	// is believed; leaving it empty turns header authentication off
+	ProxyAuthTrustedProxies []*net.IPNet
+	ProxyAuthUserHeader     string
+	ProxyAuthEmailHeader    string
+	// ProxyAuthAutoProvision creates an account for users the proxy names but
+	// Blogsite does not know yet
+	ProxyAuthAutoProvision bool
+}
+
+// OIDCEnabled reports whether single sign-on is configured
+func (c AuthConfig) OIDCEnabled() bool {
+	return c.OIDCIssuer != "" && c.OIDCClientID != ""
+}
+
+// ProxyAuthEnabled reports whether requests may be authenticated by a reverse proxy
+func (c AuthConfig) ProxyAuthEnabled() bool {
+	return len(c.ProxyAuthTrustedProxies) > 0
+}
+
+// Auth is loaded from the environment at startup; tests may override fields directly
+var Auth = LoadAuthConfig()
+
+func LoadAuthConfig() AuthConfig {
+	return AuthConfig{
+		JWTKeysDir:     os.Getenv("JWT_KEYS_DIR"),
+		JWTSecret:      os.Getenv("JWT_SECRET"),
+		JWTActiveKeyID: os.Getenv("JWT_ACTIVE_KID"),
+		JWTIssuer:      stringFromEnv("JWT_ISSUER", "blogsite"),
+		JWTAudience:    stringFromEnv("JWT_AUDIENCE", "blogsite-api"),
+		JWTClockSkew:   durationFromEnv("JWT_CLOCK_SKEW", 30*time.Second),
+
+		JWTEphemeralKey: boolFromEnv("JWT_EPHEMERAL_KEY", false),
+
+		AccessTokenTTL:  durationFromEnv("JWT_ACCESS_TTL", 15*time.Minute),
+		RefreshTokenTTL: durationFromEnv("JWT_REFRESH_TTL", 30*24*time.Hour),
+
+		RevocationCacheTTL:      durationFromEnv("REVOCATION_CACHE_TTL", 30*time.Second),
+		RevocationPruneInterval: durationFromEnv("REVOCATION_PRUNE_INTERVAL", time.Hour),
+
+		RequireEmailVerification: boolFromEnv("REQUIRE_EMAIL_VERIFICATION", Mail.Driver == "smtp"),
+		EmailVerificationTTL:     durationFromEnv("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		PasswordResetTTL:         durationFromEnv("PASSWORD_RESET_TTL", time.Hour),
+
+		TwoFactorChallengeTTL: durationFromEnv("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute),
+		TOTPIssuer:            stringFromEnv("TOTP_ISSUER", "Blogsite"),
+
+		WebAuthnRPID:    stringFromEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPName:  stringFromEnv("WEBAUTHN_RP_NAME", "Blogsite"),
+		WebAuthnOrigins: listFromEnv("WEBAUTHN_ORIGINS", []string{"http://localhost:8080"}),
+		WebAuthnTimeout: durationFromEnv("WEBAUTHN_TIMEOUT", 5*time.Minute),
+
+		MagicLinkEnabled: boolFromEnv("MAGIC_LINK_ENABLED", true),
+		MagicLinkTTL:     durationFromEnv("MAGIC_LINK_TTL", 15*time.Minute),
+
+		LoginMaxAccountFailures: intFromEnv("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+		LoginMaxIPFailures:      intFromEnv("LOGIN_MAX_IP_FAILURES", 20),
+		LoginFailureWindow:      durationFromEnv("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginLockoutBase:        durationFromEnv("LOGIN_LOCKOUT_BASE", time.Minute),
+		LoginLockoutMax:         durationFromEnv("LOGIN_LOCKOUT_MAX", time.Hour),
+
+		EmailMaxAddressRequests: intFromEnv("EMAIL_MAX_ADDRESS_REQUESTS", 3),
+		EmailMaxIPRequests:      intFromEnv("EMAIL_MAX_IP_REQUESTS", 10),
+
+		PersonalAccessTokenTTL:    durationFromEnv("PAT_TTL", 90*24*time.Hour),
+		PersonalAccessTokenMaxTTL: durationFromEnv("PAT_MAX_TTL", 365*24*time.Hour),
+
+		PasswordHashAlgorithm: stringFromEnv("PASSWORD_HASH_ALGORITHM", "bcrypt"),
+		BcryptCost:            intFromEnv("BCRYPT_COST", 10),
+		Argon2Time:            intFromEnv("ARGON2_TIME", 3),
+		Argon2MemoryKiB:       intFromEnv("ARGON2_MEMORY_KIB", 64*1024),
+		Argon2Threads:         intFromEnv("ARGON2_THREADS", 2),
+
+		PasswordMinLength:        intFromEnv("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:        intFromEnv("PASSWORD_MAX_LENGTH", 64),
+		PasswordRequireUppercase: boolFromEnv("PASSWORD_REQUIRE_UPPERCASE", true),
+		PasswordRequireLowercase: boolFromEnv("PASSWORD_REQUIRE_LOWERCASE", true),
+		PasswordRequireDigit:     boolFromEnv("PASSWORD_REQUIRE_DIGIT", true),
+		PasswordRequireSymbol:    boolFromEnv("PASSWORD_REQUIRE_SYMBOL", true),
+		PasswordMinStrength:      intRangeFromEnv("PASSWORD_MIN_STRENGTH", 2, 0, 4),
+		PasswordBreachedList:     os.Getenv("PASSWORD_BREACHED_LIST"),
+
+		AccountDeletionGracePeriod: durationFromEnv("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour),
+
+		RegistrationMode: RegistrationMode(stringFromEnv("REGISTRATION_MODE", string(RegistrationOpen))),
+		InviteTTL:        durationFromEnv("INVITE_TTL", 7*24*time.Hour),
+		InviteMaxTTL:     durationFromEnv("INVITE_MAX_TTL", 30*24*time.Hour),
+		InviteMaxUses:    intFromEnv("INVITE_MAX_USES", 25),
+
+		OIDCIssuer:        os.Getenv("OIDC_ISSUER"),
+		OIDCClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:   stringFromEnv("OIDC_REDIRECT_URL", stringFromEnv("APP_BASE_URL", "http://localhost:8080")+"/oidc/callback"),
+		OIDCScopes:        listFromEnv("OIDC_SCOPES", []string{"openid", "email", "profile"}),
+		OIDCAutoProvision: boolFromEnv("OIDC_AUTO_PROVISION", true),
+		OIDCLoginTTL:      durationFromEnv("OIDC_LOGIN_TTL", 10*time.Minute),
+
+		SessionCookies:    boolFromEnv("SESSION_COOKIES", false),
+		SessionModeHeader: stringFromEnv("SESSION_MODE_HEADER", "X-Session-Mode"),
+		SessionCookieName: stringFromEnv("SESSION_COOKIE_NAME", "blogsite_session"),
+		RefreshCookieName: stringFromEnv("REFRESH_COOKIE_NAME", "blogsite_refresh"),
+		CSRFCookieName:    stringFromEnv("CSRF_COOKIE_NAME", "blogsite_csrf"),
+		CSRFHeader:        stringFromEnv("CSRF_HEADER", "X-CSRF-Token"),
+		CookieDomain:      os.Getenv("COOKIE_DOMAIN"),
+		CookieSecure:      boolFromEnv("COOKIE_SECURE", true),
+		CookieSameSite:    stringFromEnv("COOKIE_SAME_SITE", "lax"),
+
+		ProxyAuthTrustedProxies: cidrsFromEnv("PROXY_AUTH_TRUSTED_PROXIES"),
+		ProxyAuthUserHeader:     stringFromEnv("PROXY_AUTH_USER_HEADER", "X-Forwarded-User"),
+		ProxyAuthEmailHeader:    stringFromEnv("PROXY_AUTH_EMAIL_HEADER", "X-Forwarded-Email"),
+		ProxyAuthAutoProvision:  boolFromEnv("PROXY_AUTH_AUTO_PROVISION", true),
+	}
+}
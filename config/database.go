@@ -29,15 +29,39 @@ func InitDB() {
 		dbHost, dbUser, dbPassword, dbName, dbPort)
 
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// Accounts created before email verification existed are treated as verified
+	grandfatherVerified := DB.Migrator().HasTable(&models.User{}) &&
+		!DB.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
+	// Emails are compared lowercased from now on; addresses stored before that
+	// are lowercased once so the case-insensitive unique index can be built
+	normalizeEmails := DB.Migrator().HasTable(&models.User{}) &&
+		!DB.Migrator().HasIndex(&models.User{}, "idx_users_email_lower")
+	if normalizeEmails {
+		if err := DB.Exec("UPDATE users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email))").Error; err != nil {
+			log.Fatalf("Failed to lowercase existing emails, check for accounts whose addresses differ only in case: %v", err)
+		}
+	}
+
 	// Automigrate models
-	err = DB.AutoMigrate(&models.User{}, &models.Blog{})
-	if err != nil {
+	if err := Migrate(DB); err != nil {
 		log.Fatalf("Failed to auto-migrate models: %v", err)
 	}
+
+	if grandfatherVerified {
+		if err := DB.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			log.Fatalf("Failed to mark existing users as verified: %v", err)
+		}
+	}
 	fmt.Println("Database connection established and models migrated!")
 }
+
+// Migrate creates or updates the tables of every model
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&models.User{}, &models.Blog{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.PasswordResetToken{}, &models.RecoveryCode{}, &models.WebAuthnCredential{}, &models.LoginThrottle{}, &models.PersonalAccessToken{}, &models.Session{}, &models.Invite{}, &models.OIDCIdentity{}, &models.OIDCLogin{})
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func stringFromEnv(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// listFromEnv splits a comma-separated variable, dropping empty entries
+func listFromEnv(name string, fallback []string) []string {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// cidrsFromEnv parses a comma-separated list of CIDRs, where a bare address
+// stands for itself. Invalid entries are logged and skipped.
+func cidrsFromEnv(name string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, item := range listFromEnv(name, nil) {
+		if ip := net.ParseIP(item); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			log.Printf("Invalid network %q in %s, skipping it", item, name)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+func boolFromEnv(name string, fallback bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean %q for %s, using %t", value, name, fallback)
+		return fallback
+	}
+	return b
+}
+
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid number %q for %s, using %d", value, name, fallback)
+		return fallback
+	}
+	return n
+}
+
+// intRangeFromEnv is intFromEnv for settings where zero is meaningful
+func intRangeFromEnv(name string, fallback, min, max int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		log.Printf("Invalid number %q for %s, using %d", value, name, fallback)
+		return fallback
+	}
+	return n
+}
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid duration %q for %s, using %s", value, name, fallback)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+// LDAPConfig describes the directory users may log in with, see utils.LDAPDirectory
+type LDAPConfig struct {
+	// URL is ldap:// or ldaps://; leaving it empty turns LDAP login off
+	URL      string
+	StartTLS bool
+	Timeout  time.Duration
+
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds the user's entry; {username} is replaced by the login name
+	UserFilter        string
+	UsernameAttribute string
+	EmailAttribute    string
+
+	GroupAttribute string
+	GroupBaseDN    string
+	GroupFilter    string
+
+	// Members of these groups (by DN) get the matching role, the highest one
+	// winning. When any is set, users in none of them cannot log in.
+	AdminGroup  string
+	EditorGroup string
+	AuthorGroup string
+	ReaderGroup string
+}
+
+// LDAP is loaded from the environment at startup; tests may override fields directly
+var LDAP = LoadLDAPConfig()
+
+func LoadLDAPConfig() LDAPConfig {
+	return LDAPConfig{
+		URL:      os.Getenv("LDAP_URL"),
+		StartTLS: boolFromEnv("LDAP_START_TLS", false),
+		Timeout:  durationFromEnv("LDAP_TIMEOUT", 10*time.Second),
+
+		BindDN:            os.Getenv("LDAP_BIND_DN"),
+		BindPassword:      os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:            os.Getenv("LDAP_BASE_DN"),
+		UserFilter:        stringFromEnv("LDAP_USER_FILTER", "(uid={username})"),
+		UsernameAttribute: stringFromEnv("LDAP_USERNAME_ATTRIBUTE", "uid"),
+		EmailAttribute:    stringFromEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+
+		GroupAttribute: stringFromEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+		GroupBaseDN:    os.Getenv("LDAP_GROUP_BASE_DN"),
+		GroupFilter:    stringFromEnv("LDAP_GROUP_FILTER", "(member={dn})"),
+
+		AdminGroup:  os.Getenv("LDAP_ADMIN_GROUP"),
+		EditorGroup: os.Getenv("LDAP_EDITOR_GROUP"),
+		AuthorGroup: os.Getenv("LDAP_AUTHOR_GROUP"),
+		ReaderGroup: os.Getenv("LDAP_READER_GROUP"),
+	}
+}
+
+// Enabled reports whether LDAP login is configured
+func (c LDAPConfig) Enabled() bool {
+	return c.URL != ""
+}
@@ -0,0 +1,34 @@
+package config
+
+import "os"
+
+// MailConfig selects and configures the outbound mailer, see utils.NewMailer
+type MailConfig struct {
+	// Driver is "smtp", "file" or "memory"
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	// OutboxDir is where the file driver writes one .eml file per message
+	OutboxDir string
+	// BaseURL is prepended to the links sent in emails
+	BaseURL string
+}
+
+// Mail is loaded from the environment at startup; tests may override fields directly
+var Mail = LoadMailConfig()
+
+func LoadMailConfig() MailConfig {
+	return MailConfig{
+		Driver:       stringFromEnv("MAIL_DRIVER", "file"),
+		From:         stringFromEnv("MAIL_FROM", "Blogsite <no-reply@blogsite.local>"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     stringFromEnv("SMTP_PORT", "587"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		OutboxDir:    stringFromEnv("MAIL_OUTBOX_DIR", "outbox"),
+		BaseURL:      stringFromEnv("APP_BASE_URL", "http://localhost:8080"),
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	middleware "Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// sendAccountDeletionEmail tells the user when their account will be purged
+func sendAccountDeletionEmail(user models.User, purgeAt time.Time) error {
+	return utils.DefaultMailer.Send(utils.Message{
+		To:      user.Email,
+		Subject: "Your Blogsite account has been deleted",
+		Body: fmt.Sprintf("Hi %s,\n\nYour Blogsite account and its blogs have been deleted. "+
+			"They will be removed for good on %s. If you did not ask for this, contact us before then to restore the account.\n",
+			user.Username, purgeAt.Format("2 January 2006")),
+	})
+}
+
+// DeleteAccount closes the current user's account after checking the
+// password. The account and its blogs disappear at once and are purged after
+// config.Auth.AccountDeletionGracePeriod, until when an admin can restore them.
+// Proxy users have no password; the proxy vouching for them on the request
+// stands in for it.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	var input struct {
+		Password string `json:"password"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Requests authenticated by the proxy carry no token
+	_, hasToken := r.Context().Value(middleware.TokenIDKey).(string)
+	if user.AuthSource != models.AuthSourceProxy || hasToken {
+		if input.Password == "" {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if loginThrottled(w, utils.AccountThrottleKey(user.ID)) {
+			return
+		}
+		if _, err := authenticate(user, input.Password); err != nil {
+			recordLoginFailure(r, user.ID)
+			http.Error(w, "Password is incorrect", http.StatusForbidden)
+			return
+		}
+	}
+
+	// The blogs share the account's deletion time, so a restore brings back
+	// exactly these and not ones the user had deleted before
+	now := time.Now()
+	err := utils.Transaction(config.DB, func(tx *gorm.DB) error {
+		if err := revokeAllSessions(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Blog{}).Where("user_id = ?", user.ID).Update("deleted_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Update("deleted_at", now).Error
+	})
+	if err != nil {
+		log.Printf("Error deleting account: %v", err)
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	purgeAt := now.Add(config.Auth.AccountDeletionGracePeriod)
+	if err := sendAccountDeletionEmail(user, purgeAt); err != nil {
+		log.Printf("Error sending account deletion email: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Account successfully deleted",
+		"purge_at": purgeAt,
+	})
+}
+
+// RestoreUser undoes DeleteAccount during the grace period (admin only)
+func RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var user models.User
+	if err := config.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&user, id).Error; err != nil {
+		http.Error(w, "Deleted user not found", http.StatusNotFound)
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Blog{}).
+			Where("user_id = ? AND deleted_at = ?", user.ID, user.DeletedAt.Time).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&user).Update("deleted_at", nil).Error
+	})
+	if err != nil {
+		log.Printf("Error restoring user: %v", err)
+		http.Error(w, "Failed to restore user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User successfully restored"})
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAccountDeletion(t *testing.T) {
+	setupTestDB(t)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("Password!23"), bcrypt.MinCost)
+	now := time.Now()
+	user := createTestUser(t, models.User{Username: "DeleteMeUser", Email: "deleteme@example.com", Password: string(hash), EmailVerifiedAt: &now})
+
+	kept := models.Blog{Title: "Kept", UserID: user.ID}
+	removedEarlier := models.Blog{Title: "Removed earlier", UserID: user.ID}
+	config.DB.Create(&kept)
+	config.DB.Create(&removedEarlier)
+	config.DB.Delete(&removedEarlier)
+
+	deleteAccount := func(password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"password": password})
+		req := httptest.NewRequest("DELETE", "/api/user", bytes.NewBuffer(body))
+		req = req.WithContext(context.WithValue(req.Context(), middlewares.UserIDKey, user.ID))
+		rr := httptest.NewRecorder()
+		DeleteAccount(rr, req)
+		return rr
+	}
+
+	if rr := deleteAccount("WrongPassword!23"); rr.Code != http.StatusForbidden {
+		t.Fatalf("Expected wrong password to be rejected, got %v", rr.Code)
+	}
+	utils.ResetLoginFailures(utils.AccountThrottleKey(user.ID))
+
+	if rr := deleteAccount("Password!23"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected deletion to succeed, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if err := config.DB.First(&models.User{}, user.ID).Error; err == nil {
+		t.Error("Expected the user to be hidden after deletion")
+	}
+	if err := config.DB.First(&models.Blog{}, kept.ID).Error; err == nil {
+		t.Error("Expected the user's blogs to be hidden after deletion")
+	}
+
+	body, _ := json.Marshal(map[string]string{"identifier": user.Username, "password": "Password!23"})
+	login := httptest.NewRecorder()
+	Login(login, httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body)))
+	if login.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a deleted user not to log in, got %v", login.Code)
+	}
+
+	// An admin can restore the account with the blogs deleted along with it
+	router := mux.NewRouter()
+	router.HandleFunc("/api/admin/users/{id}/restore", RestoreUser).Methods("POST")
+	restore := httptest.NewRecorder()
+	router.ServeHTTP(restore, httptest.NewRequest("POST", "/api/admin/users/"+strconv.Itoa(int(user.ID))+"/restore", nil))
+	if restore.Code != http.StatusOK {
+		t.Fatalf("Expected restore to succeed, got %v: %s", restore.Code, restore.Body.String())
+	}
+	if err := config.DB.First(&models.Blog{}, kept.ID).Error; err != nil {
+		t.Error("Expected the blog deleted with the account to be restored")
+	}
+	if err := config.DB.First(&models.Blog{}, removedEarlier.ID).Error; err == nil {
+		t.Error("Expected the blog deleted before the account to stay deleted")
+	}
+
+	// Once the grace period is over the account is purged for good
+	if rr := deleteAccount("Password!23"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected second deletion to succeed, got %v", rr.Code)
+	}
+	if err := utils.PurgeDeletedAccounts(time.Now().Add(config.Auth.AccountDeletionGracePeriod - time.Minute)); err != nil {
+		t.Fatalf("PurgeDeletedAccounts: %v", err)
+	}
+	if err := config.DB.Unscoped().First(&models.User{}, user.ID).Error; err != nil {
+		t.Error("Expected the account to survive the grace period")
+	}
+	if err := utils.PurgeDeletedAccounts(time.Now().Add(config.Auth.AccountDeletionGracePeriod + time.Minute)); err != nil {
+		t.Fatalf("PurgeDeletedAccounts: %v", err)
+	}
+	var remaining int64
+	config.DB.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Error("Expected the account to be purged")
+	}
+	config.DB.Unscoped().Model(&models.Blog{}).Where("user_id = ?", user.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("Expected the account's blogs to be purged, %d left", remaining)
+	}
+}
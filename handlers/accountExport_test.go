@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildExportArchive(t *testing.T) {
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	profile := exportProfile{
+		SelfUser:         SelfUser{PublicUser: PublicUser{ID: 7, Username: "ExportUser", CreatedAt: created}, Email: "export@example.com", Role: "author"},
+		TwoFactorEnabled: true,
+		Passkeys:         []PasskeyResponse{},
+	}
+	posts := []BlogResponse{
+		{ID: 3, Title: "First | post [draft]", Description: "Hello\n\nWorld", UserID: 7, CreatedAt: created, UpdatedAt: created},
+	}
+	ended := created.Add(time.Hour)
+	sessions := []exportSession{
+		{SessionResponse{ID: "abc", Device: "Firefox on Linux", IP: "192.0.2.1", CreatedAt: created, LastSeenAt: created}, &ended},
+	}
+
+	data, err := buildExportArchive(profile, posts, sessions)
+	if err != nil {
+		t.Fatalf("buildExportArchive: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Archive is not a valid zip: %v", err)
+	}
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+
+	for _, name := range []string{"profile.json", "posts.json", "sessions.json", "README.md", "posts/3.md"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Expected %s in the archive, got %v", name, zr.File)
+		}
+	}
+
+	var gotProfile map[string]interface{}
+	if err := json.Unmarshal([]byte(files["profile.json"]), &gotProfile); err != nil {
+		t.Fatalf("profile.json is not valid JSON: %v", err)
+	}
+	if gotProfile["email"] != "export@example.com" || gotProfile["two_factor_enabled"] != true {
+		t.Errorf("Unexpected profile %v", gotProfile)
+	}
+	if strings.Contains(files["profile.json"], "password") {
+		t.Error("Expected no password data in the profile")
+	}
+
+	var gotSessions []map[string]interface{}
+	json.Unmarshal([]byte(files["sessions.json"]), &gotSessions)
+	if len(gotSessions) != 1 || gotSessions[0]["revoked_at"] == nil {
+		t.Errorf("Expected the ended session with its end time, got %v", gotSessions)
+	}
+
+	if !strings.Contains(files["README.md"], `- [First \| post \[draft\]](posts/3.md)`) {
+		t.Errorf("Expected README.md to link the escaped post title, got:\n%s", files["README.md"])
+	}
+	if !strings.Contains(files["README.md"], "| Firefox on Linux | 192.0.2.1 | 2024-03-01 09:30 UTC | 2024-03-01 09:30 UTC | 2024-03-01 10:30 UTC |") {
+		t.Errorf("Expected README.md to list the session, got:\n%s", files["README.md"])
+	}
+	if !strings.HasSuffix(files["posts/3.md"], "Hello\n\nWorld\n") {
+		t.Errorf("Expected the post body to be kept as written, got:\n%s", files["posts/3.md"])
+	}
+}
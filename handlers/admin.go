@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// SetUserRole handler (admin only)
+func SetUserRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var input struct {
+		Role models.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if !input.Role.Valid() {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// The role is carried in the JWT, so outstanding tokens are invalidated to apply the change
+	err := utils.Transaction(config.DB, func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("role", input.Role).Error; err != nil {
+			return err
+		}
+		return utils.Revocations.BumpTokenVersion(tx, user.ID)
+	})
+	if err != nil {
+		log.Printf("Error updating role: %v", err)
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Role successfully updated"})
+}
+
+// sendApprovalEmail tells a user their registration was approved
+func sendApprovalEmail(user models.User) error {
+	return utils.DefaultMailer.Send(utils.Message{
+		To:      user.Email,
+		Subject: "Your Blogsite account has been approved",
+		Body: fmt.Sprintf("Hi %s,\n\nAn administrator has approved your Blogsite account. You can log in at %s.\n",
+			user.Username, config.Mail.BaseURL),
+	})
+}
+
+// GetPendingUsers lists registrations waiting for approval (admin only)
+func GetPendingUsers(w http.ResponseWriter, r *http.Request) {
+	var users []models.User
+	if err := config.DB.Where("status = ?", models.StatusPending).Order("created_at").Find(&users).Error; err != nil {
+		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+		return
+	}
+
+	responses := make([]AdminUser, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, newAdminUser(user))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(responses)
+}
+
+// ApproveUser lets a pending user log in (admin only)
+func ApproveUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var user models.User
+	if err := config.DB.Where("status = ?", models.StatusPending).First(&user, id).Error; err != nil {
+		http.Error(w, "Pending user not found", http.StatusNotFound)
+		return
+	}
+
+	if err := config.DB.Model(&user).Update("status", models.StatusActive).Error; err != nil {
+		log.Printf("Error approving user: %v", err)
+		http.Error(w, "Failed to approve user", http.StatusInternalServerError)
+		return
+	}
+	if err := sendApprovalEmail(user); err != nil {
+		log.Printf("Error sending approval email: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User successfully approved"})
+}
+
+// RejectUser deletes a pending registration for good, freeing its username
+// and email (admin only)
+func RejectUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var user models.User
+	if err := config.DB.Where("status = ?", models.StatusPending).First(&user, id).Error; err != nil {
+		http.Error(w, "Pending user not found", http.StatusNotFound)
+		return
+	}
+
+	if err := utils.PurgeAccount(user.ID); err != nil {
+		log.Printf("Error rejecting user: %v", err)
+		http.Error(w, "Failed to reject user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User successfully rejected"})
+}
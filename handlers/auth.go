@@ -5,23 +5,49 @@ import (
 	"Blogsite/models"
 	"Blogsite/utils"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"net/mail"
 	"regexp"
+	"strings"
 
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func Register(w http.ResponseWriter, r *http.Request) {
-	var user models.User
+	var input struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		// InviteCode is required while registration is invite-only
+		InviteCode string `json:"invite_code"`
+	}
 
-	// Decode the request body into user struct
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	// Decode the request body into the input struct
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
+	// Roles are only ever granted by an admin
+	user := models.User{
+		Username: input.Username,
+		Email:    normalizeEmail(input.Email),
+		Password: input.Password,
+		Role:     models.RoleAuthor,
+		Status:   models.StatusActive,
+	}
+	if config.Auth.RegistrationMode == config.RegistrationApproval {
+		user.Status = models.StatusPending
+	}
+	if config.Auth.RegistrationMode == config.RegistrationInvite && input.InviteCode == "" {
+		http.Error(w, "An invite code is required to register", http.StatusForbidden)
+		return
+	}
+
 	// Validate username
 	if err := validateUsername(user.Username); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -35,29 +61,69 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate password strength
-	if err := validatePassword(user.Password); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := validatePassword(user.Password, user.Username, user.Email); err != nil {
+		writePasswordError(w, err)
 		return
 	}
 
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
 		http.Error(w, "Error hashing password", http.StatusInternalServerError)
 		return
 	}
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
 
-	// Create user in the database
-	if err := config.DB.Create(&user).Error; err != nil {
+	// Check up front for a friendly message; the unique indexes still catch races below
+	taken, err := usernameOrEmailTaken(user.Username, user.Email, 0)
+	if err != nil {
+		log.Printf("Error checking for duplicate users: %v", err)
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
 		return
 	}
+	if taken {
+		http.Error(w, "Username or email already in use", http.StatusConflict)
+		return
+	}
+
+	// Create user in the database, using up the invite in the same transaction
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if config.Auth.RegistrationMode == config.RegistrationInvite {
+			inviterID, err := useInvite(tx, input.InviteCode)
+			if err != nil {
+				return err
+			}
+			user.InvitedByID = &inviterID
+		}
+		return tx.Create(&user).Error
+	})
+	if errors.Is(err, errInviteInvalid) {
+		http.Error(w, "Invite code is invalid, used up or expired", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		http.Error(w, "Username or email already in use", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		return
+	}
+
+	// The account stays unverified until the emailed link is followed; a failed
+	// send is not fatal since the user can ask for the link again
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("Error sending verification email: %v", err)
+	}
 
 	// Send success response
+	message := "User successfully registered"
+	if user.Status == models.StatusPending {
+		message = "User successfully registered; an administrator must approve the account before you can log in"
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	response := map[string]string{"message": "User successfully registered"}
+	response := map[string]string{"message": message}
 	json.NewEncoder(w).Encode(response)
 }
 
@@ -73,38 +139,78 @@ func validateUsername(username string) error {
 	return nil
 }
 
+// isValidEmail accepts a bare address, not one with a display name
 func isValidEmail(email string) bool {
-	_, err := mail.ParseAddress(email)
-	return err == nil
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
 }
 
-func validatePassword(password string) error {
-	var (
-		minLength   = 8
-		uppercase   = regexp.MustCompile(`[A-Z]`)
-		lowercase   = regexp.MustCompile(`[a-z]`)
-		number      = regexp.MustCompile(`[0-9]`)
-		specialChar = regexp.MustCompile(`[!@#~$%^&*()+|_]{1}`)
-	)
+// normalizeEmail is the form emails are stored and looked up in
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
 
-	if len(password) < minLength {
-		return fmt.Errorf("Password must be at least %d characters long", minLength)
-	}
-	if !uppercase.MatchString(password) {
-		return fmt.Errorf("Password must contain at least one uppercase letter")
+// usernameOrEmailTaken reports whether another user than exceptID has the
+// username or email, ignoring case
+func usernameOrEmailTaken(username, email string, exceptID uint) (bool, error) {
+	var conflicts int64
+	err := config.DB.Model(&models.User{}).
+		Where("(LOWER(username) = LOWER(?) OR LOWER(email) = ?) AND id <> ?", username, normalizeEmail(email), exceptID).
+		Count(&conflicts).Error
+	return conflicts > 0, err
+}
+
+// findUserByIdentifier looks a user up by username or email, ignoring case.
+// Usernames cannot contain "@", so an identifier only ever matches one field.
+func findUserByIdentifier(identifier string) (models.User, error) {
+	var users []models.User
+	query := config.DB.Limit(2)
+	if strings.Contains(identifier, "@") {
+		query = query.Where("LOWER(email) = ?", normalizeEmail(identifier))
+	} else {
+		// Usernames registered before lookups ignored case may differ only in
+		// case; the exact one wins and otherwise the identifier is ambiguous
+		query = query.Where("LOWER(username) = LOWER(?)", identifier).
+			Order(clause.Expr{SQL: "username = ? DESC", Vars: []interface{}{identifier}})
 	}
-	if !lowercase.MatchString(password) {
-		return fmt.Errorf("Password must contain at least one lowercase letter")
+	if err := query.Find(&users).Error; err != nil {
+		return models.User{}, err
 	}
-	if !number.MatchString(password) {
-		return fmt.Errorf("Password must contain at least one number")
+
+	if len(users) == 0 || (len(users) > 1 && users[0].Username != identifier) {
+		return models.User{}, gorm.ErrRecordNotFound
 	}
-	if !specialChar.MatchString(password) {
-		return fmt.Errorf("Password must contain at least one special character (!@#~$%%^&*()+|_)")
+	return users[0], nil
+}
+
+// passwordPolicyError lists every password rule a new password breaks
+type passwordPolicyError []string
+
+func (e passwordPolicyError) Error() string {
+	return strings.Join(e, "; ")
+}
+
+// validatePassword checks a new password against the configured policy.
+// userInputs are the account's own details, which make a password guessable.
+func validatePassword(password string, userInputs ...string) error {
+	if violations := utils.CurrentPasswordPolicy().Check(password, userInputs...); len(violations) > 0 {
+		return passwordPolicyError(violations)
 	}
 	return nil
 }
 
+func writePasswordError(w http.ResponseWriter, err error) {
+	var violations passwordPolicyError
+	errors.As(err, &violations)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Password does not meet the requirements",
+		"violations": violations,
+	})
+}
+
 func Login(w http.ResponseWriter, r *http.Request) {
 	var creds models.Credentials
 	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
@@ -117,24 +223,54 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var user models.User
-
-	if err := config.DB.Where("username = ?", creds.Username).First(&user).Error; err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	if loginThrottled(w, utils.IPThrottleKey(utils.ClientIP(r))) {
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password)); err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	identifier := creds.LoginIdentifier()
+	user, err := findUserByIdentifier(identifier)
+	switch {
+	case err == nil:
+		if loginThrottled(w, utils.AccountThrottleKey(user.ID)) {
+			return
+		}
+		user, err = authenticate(user, creds.Password)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		user, err = provision(identifier, creds.Password)
+	}
+	if err != nil {
+		writeLoginError(w, r, user.ID, err)
 		return
 	}
+	accountKey := utils.AccountThrottleKey(user.ID)
 
-	token, err := utils.GenerateJWT(user.ID)
-	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+	// Only the account is cleared; the address keeps its count so that a valid
+	// login cannot be used to reset an attack from the same client
+	if err := utils.ResetLoginFailures(accountKey); err != nil {
+		log.Printf("Error resetting login failures: %v", err)
+	}
+
+	if config.Auth.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		http.Error(w, "Email address has not been verified", http.StatusForbidden)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	completeLogin(w, r, user)
+}
+
+// writeLoginError answers a failed login. Only wrong credentials count
+// towards lockouts; userID is 0 when the account is not known.
+func writeLoginError(w http.ResponseWriter, r *http.Request, userID uint, err error) {
+	switch {
+	case errors.Is(err, errInvalidCredentials), errors.Is(err, errUnknownUser), errors.Is(err, gorm.ErrRecordNotFound):
+		recordLoginFailure(r, userID)
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	case errors.Is(err, errNoRole):
+		http.Error(w, "Your directory account is not allowed to use Blogsite", http.StatusForbidden)
+	case errors.Is(err, errLDAPNoEmail), errors.Is(err, errLDAPAccountConflict), errors.Is(err, errLDAPInvalidUsername):
+		http.Error(w, "Your directory account cannot be used to log in: "+err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Error checking credentials: %v", err)
+		http.Error(w, "Could not check credentials, try again later", http.StatusServiceUnavailable)
+	}
 }
@@ -8,21 +8,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
-
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
 func TestRegister(t *testing.T) {
-	// Ensure the database is initialized
-	if config.DB == nil {
-		dsn := "host=localhost user=postgres password=Postgresql@1234 dbname=blogsite_db port=5432 sslmode=disable"
-		var err error
-		config.DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-		if err != nil {
-			t.Fatalf("Failed to connect to database: %v", err)
-		}
-	}
+	setupTestDB(t)
 
 	// Start a transaction and defer a rollback
 	tx := config.DB.Begin()
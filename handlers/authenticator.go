@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Errors an Authenticator returns when a login does not match. Anything else
+// means the password could not be checked at all.
+var (
+	errInvalidCredentials = errors.New("invalid credentials")
+	// errUnknownUser lets Login try the next authenticator that can provision users
+	errUnknownUser = errors.New("unknown user")
+	// errNoRole refuses directory users who are in none of the mapped groups
+	errNoRole              = errors.New("user is in no group that grants a role")
+	errLDAPNoEmail         = errors.New("directory account has no email address")
+	errLDAPAccountConflict = errors.New("a local account with this username or email already exists")
+	// errLDAPInvalidUsername refuses directory names Blogsite would not accept
+	// on registration, such as ones with an @ that would be taken for an email
+	errLDAPInvalidUsername = errors.New("directory username is not a valid Blogsite username")
+)
+
+// Authenticator checks the passwords of the users whose AuthSource it is
+// registered for. It returns the user as it should be logged in, which lets
+// it update details kept elsewhere, such as the role.
+type Authenticator interface {
+	Authenticate(user models.User, password string) (models.User, error)
+}
+
+// Provisioner is an Authenticator that can also create the account of a user
+// it knows but Blogsite does not yet, on their first login
+type Provisioner interface {
+	Authenticator
+	Provision(identifier, password string) (models.User, error)
+}
+
+var (
+	authenticators     = map[models.AuthSource]Authenticator{}
+	authenticatorOrder []models.AuthSource
+)
+
+func init() {
+	RegisterAuthenticator(models.AuthSourceLocal, passwordAuthenticator{})
+	RegisterAuthenticator(models.AuthSourceLDAP, ldapAuthenticator{})
+}
+
+// RegisterAuthenticator sets the authenticator for users whose AuthSource is
+// source. Provisioners are asked about unknown users in registration order.
+func RegisterAuthenticator(source models.AuthSource, a Authenticator) {
+	if _, ok := authenticators[source]; !ok {
+		authenticatorOrder = append(authenticatorOrder, source)
+	}
+	authenticators[source] = a
+}
+
+func authenticatorFor(user models.User) Authenticator {
+	if user.AuthSource == "" {
+		return authenticators[models.AuthSourceLocal]
+	}
+	return authenticators[user.AuthSource]
+}
+
+// authenticate checks the password of a known user with their authenticator
+func authenticate(user models.User, password string) (models.User, error) {
+	a := authenticatorFor(user)
+	if a == nil {
+		return user, errInvalidCredentials
+	}
+	return a.Authenticate(user, password)
+}
+
+// provision asks every Provisioner in turn whether it knows identifier
+func provision(identifier, password string) (models.User, error) {
+	for _, source := range authenticatorOrder {
+		p, ok := authenticators[source].(Provisioner)
+		if !ok {
+			continue
+		}
+		user, err := p.Provision(identifier, password)
+		if !errors.Is(err, errUnknownUser) {
+			return user, err
+		}
+	}
+	return models.User{}, errInvalidCredentials
+}
+
+// hasLocalPassword reports whether the user's password is kept by Blogsite,
+// and so can be changed or reset here
+func hasLocalPassword(user models.User) bool {
+	return user.AuthSource == "" || user.AuthSource == models.AuthSourceLocal
+}
+
+// passwordAuthenticator checks the hash stored with the user
+type passwordAuthenticator struct{}
+
+func (passwordAuthenticator) Authenticate(user models.User, password string) (models.User, error) {
+	if err := utils.CheckPassword(user.Password, password); err != nil {
+		return user, errInvalidCredentials
+	}
+	rehashPassword(user, password)
+	return user, nil
+}
+
+// ldapAuthenticator binds to the directory in config.LDAP as the user and
+// keeps the account's email and role in step with the directory
+type ldapAuthenticator struct{}
+
+func ldapDirectory() utils.LDAPDirectory {
+	return utils.LDAPDirectory{
+		URL:               config.LDAP.URL,
+		StartTLS:          config.LDAP.StartTLS,
+		Timeout:           config.LDAP.Timeout,
+		BindDN:            config.LDAP.BindDN,
+		BindPassword:      config.LDAP.BindPassword,
+		BaseDN:            config.LDAP.BaseDN,
+		UserFilter:        config.LDAP.UserFilter,
+		UsernameAttribute: config.LDAP.UsernameAttribute,
+		EmailAttribute:    config.LDAP.EmailAttribute,
+		GroupAttribute:    config.LDAP.GroupAttribute,
+		GroupBaseDN:       config.LDAP.GroupBaseDN,
+		GroupFilter:       config.LDAP.GroupFilter,
+	}
+}
+
+// ldapLogin authenticates against the directory, translating its errors.
+// Known users are looked up by the DN recorded for them, new ones by name.
+func ldapLogin(user models.User, username, password string) (*utils.LDAPAccount, error) {
+	if !config.LDAP.Enabled() {
+		return nil, errUnknownUser
+	}
+	var account *utils.LDAPAccount
+	var err error
+	if user.ExternalID != "" {
+		account, err = ldapDirectory().AuthenticateDN(user.ExternalID, password)
+	} else {
+		account, err = ldapDirectory().Authenticate(username, password)
+	}
+	switch {
+	case errors.Is(err, utils.ErrLDAPUnknownUser):
+		return nil, errUnknownUser
+	case errors.Is(err, utils.ErrLDAPInvalidCredentials):
+		return nil, errInvalidCredentials
+	}
+	return account, err
+}
+
+// ldapRole maps the user's groups to a role. ok is false when no group
+// mapping is configured, in which case roles are managed in Blogsite.
+func ldapRole(groups []string) (role models.Role, ok bool, err error) {
+	mapping := []struct {
+		role  models.Role
+		group string
+	}{
+		{models.RoleAdmin, config.LDAP.AdminGroup},
+		{models.RoleEditor, config.LDAP.EditorGroup},
+		{models.RoleAuthor, config.LDAP.AuthorGroup},
+		{models.RoleReader, config.LDAP.ReaderGroup},
+	}
+
+	configured := false
+	for _, m := range mapping {
+		if m.group == "" {
+			continue
+		}
+		configured = true
+		for _, group := range groups {
+			if strings.EqualFold(strings.TrimSpace(group), strings.TrimSpace(m.group)) {
+				return m.role, true, nil
+			}
+		}
+	}
+	if configured {
+		return "", true, errNoRole
+	}
+	return "", false, nil
+}
+
+func (ldapAuthenticator) Authenticate(user models.User, password string) (models.User, error) {
+	// Accounts provisioned before DNs were recorded are matched by name once
+	account, err := ldapLogin(user, user.Username, password)
+	if errors.Is(err, errUnknownUser) {
+		// Users removed from the directory cannot log in any more
+		return user, errInvalidCredentials
+	}
+	if err != nil {
+		return user, err
+	}
+
+	role, syncRole, err := ldapRole(account.Groups)
+	if err != nil {
+		return user, err
+	}
+
+	updates := map[string]interface{}{}
+	if email := normalizeEmail(account.Email); isValidEmail(email) && email != user.Email {
+		// An address another account already has is left alone rather than
+		// failing the login
+		if taken, err := usernameOrEmailTaken(user.Username, email, user.ID); err != nil {
+			return user, err
+		} else if !taken {
+			updates["email"] = email
+		}
+	}
+	if syncRole && role != user.Role {
+		updates["role"] = role
+	}
+	if user.ExternalID == "" {
+		updates["external_id"] = account.DN
+	}
+	if len(updates) == 0 {
+		return user, nil
+	}
+
+	err = utils.Transaction(config.DB, func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if _, changed := updates["role"]; changed {
+			// As with SetUserRole, tokens carrying the old role stop working
+			if err := utils.Revocations.BumpTokenVersion(tx, user.ID); err != nil {
+				return err
+			}
+			return tx.First(&user, user.ID).Error
+		}
+		return nil
+	})
+	return user, err
+}
+
+// Provision creates the account of a directory user logging in for the first
+// time. Local accounts with the same username or email are never taken over.
+func (ldapAuthenticator) Provision(identifier, password string) (models.User, error) {
+	account, err := ldapLogin(models.User{}, identifier, password)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	role, syncRole, err := ldapRole(account.Groups)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if err := validateUsername(account.Username); err != nil {
+		return models.User{}, fmt.Errorf("%w: %v", errLDAPInvalidUsername, err)
+	}
+	email := normalizeEmail(account.Email)
+	if !isValidEmail(email) {
+		return models.User{}, errLDAPNoEmail
+	}
+	taken, err := usernameOrEmailTaken(account.Username, email, 0)
+	if err != nil {
+		return models.User{}, err
+	}
+	if taken {
+		return models.User{}, errLDAPAccountConflict
+	}
+
+	// The directory vouches for the address
+	now := time.Now()
+	user := models.User{
+		Username:        account.Username,
+		Email:           email,
+		AuthSource:      models.AuthSourceLDAP,
+		ExternalID:      account.DN,
+		EmailVerifiedAt: &now,
+	}
+	if syncRole {
+		user.Role = role
+	}
+	if err := config.DB.Create(&user).Error; err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	middleware "Blogsite/middlewares"
+	"Blogsite/models"
+	"net/http"
+)
+
+// authorize checks the permission matrix for an action on a resource owned by
+// ownerID: the caller needs ownPerm if they own it and anyPerm otherwise
+func authorize(r *http.Request, ownerID uint, ownPerm, anyPerm models.Permission) bool {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	if ownerID == userID && middleware.Allowed(r.Context(), ownPerm) {
+		return true
+	}
+	return middleware.Allowed(r.Context(), anyPerm)
+}
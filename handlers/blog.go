@@ -16,12 +16,22 @@ func CreateBlog(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(middleware.UserIDKey).(uint)
 	log.Printf("CreateBlog: user ID from context: %v", userID)
 
-	var blog models.Blog
-	if err := json.NewDecoder(r.Body).Decode(&blog); err != nil {
+	var input blogInput
+	errs, err := decodeStrict(r, &input)
+	if err != nil {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
-	blog.UserID = userID
+	if errs == nil {
+		errs = input.validate(true)
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, errs)
+		return
+	}
+
+	blog := models.Blog{UserID: userID}
+	input.apply(&blog)
 
 	if err := config.DB.Create(&blog).Error; err != nil {
 		log.Printf("Error creating blog: %v", err)
@@ -30,7 +40,7 @@ func CreateBlog(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(blog)
+	json.NewEncoder(w).Encode(newBlogResponse(blog))
 }
 
 // GetUserBlogs handler (All user tasks)
@@ -45,7 +55,7 @@ func GetUserBlogs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(blogs)
+	json.NewEncoder(w).Encode(newBlogResponses(blogs))
 }
 
 func GetAllBlogs(w http.ResponseWriter, r *http.Request) {
@@ -56,7 +66,7 @@ func GetAllBlogs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(blogs)
+	json.NewEncoder(w).Encode(newBlogResponses(blogs))
 }
 
 // UpdateBlog handler
@@ -73,15 +83,25 @@ func UpdateBlog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if blog.UserID != userID {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !authorize(r, blog.UserID, models.PermBlogsUpdateOwn, models.PermBlogsUpdateAny) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&blog); err != nil {
+	var input blogInput
+	errs, err := decodeStrict(r, &input)
+	if err != nil {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
+	if errs == nil {
+		errs = input.validate(false)
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, errs)
+		return
+	}
+	input.apply(&blog)
 
 	if err := config.DB.Save(&blog).Error; err != nil {
 		http.Error(w, "Failed to update blog", http.StatusInternalServerError)
@@ -89,7 +109,7 @@ func UpdateBlog(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(blog)
+	json.NewEncoder(w).Encode(newBlogResponse(blog))
 }
 
 // DeleteBlog handler
@@ -106,8 +126,8 @@ func DeleteBlog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if blog.UserID != userID {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !authorize(r, blog.UserID, models.PermBlogsDeleteOwn, models.PermBlogsDeleteAny) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
@@ -133,5 +153,5 @@ func GetBlogById(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(blog)
+	json.NewEncoder(w).Encode(newBlogResponse(blog))
 }
@@ -18,8 +18,7 @@ import (
 )
 
 func TestBlogCRUD(t *testing.T) {
-	// Initialize the database
-	config.InitDB()
+	setupTestDB(t)
 
 	// Start a transaction
 	tx := config.DB.Begin()
@@ -44,7 +43,7 @@ func TestBlogCRUD(t *testing.T) {
 	defer tx.Rollback()
 
 	// Generate a valid JWT token for testing
-	token, err := utils.GenerateJWT(user.ID)
+	token, err := utils.GenerateJWT(user)
 	if err != nil {
 		t.Fatalf("Failed to generate JWT: %v", err)
 	}
@@ -53,11 +52,10 @@ func TestBlogCRUD(t *testing.T) {
 	t.Run("CreateBlog", func(t *testing.T) {
 		authMiddleware := middlewares.AuthMiddleware(http.HandlerFunc(CreateBlog))
 
-		blog := models.Blog{
-			Title:       "Test Blog CRUD",
-			Description: "This is a test blog for CRUD.",
-			Completed:   false,
-			UserID:      user.ID,
+		blog := map[string]interface{}{
+			"title":       "Test Blog CRUD",
+			"description": "This is a test blog for CRUD.",
+			"completed":   false,
 		}
 
 		body, _ := json.Marshal(blog)
@@ -80,8 +78,8 @@ func TestBlogCRUD(t *testing.T) {
 			t.Fatalf("Could not decode response: %v", err)
 		}
 
-		if createdBlog.Title != blog.Title {
-			t.Fatalf("Expected blog title to be %v, got %v", blog.Title, createdBlog.Title)
+		if createdBlog.Title != blog["title"] {
+			t.Fatalf("Expected blog title to be %v, got %v", blog["title"], createdBlog.Title)
 		}
 	})
 
@@ -93,8 +91,7 @@ func TestBlogCRUD(t *testing.T) {
 
 	// Update the created blog post
 	t.Run("UpdateBlog", func(t *testing.T) {
-		blog.Description = "Updated description for CRUD"
-		body, _ := json.Marshal(blog)
+		body, _ := json.Marshal(map[string]string{"description": "Updated description for CRUD"})
 		req := httptest.NewRequest("PUT", "/api/user/blog/"+strconv.Itoa(int(blog.ID)), bytes.NewBuffer(body))
 		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(blog.ID))})
 		req.Header.Set("Authorization", "Bearer "+token)
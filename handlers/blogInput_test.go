@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBlogInputRejectsMassAssignment(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        string
+		expectedErrors map[string]string
+	}{
+		{
+			name:           "Overwriting the owner",
+			payload:        `{"title": "Hijack", "user_id": 99}`,
+			expectedErrors: map[string]string{"user_id": "is not allowed"},
+		},
+		{
+			name:           "Overwriting the ID",
+			payload:        `{"title": "Hijack", "ID": 5}`,
+			expectedErrors: map[string]string{"ID": "is not allowed"},
+		},
+		{
+			name:           "Setting DeletedAt",
+			payload:        `{"title": "Hijack", "DeletedAt": "2024-01-01T00:00:00Z"}`,
+			expectedErrors: map[string]string{"DeletedAt": "is not allowed"},
+		},
+		{
+			name:           "Missing title",
+			payload:        `{"description": "No title"}`,
+			expectedErrors: map[string]string{"title": "is required"},
+		},
+		{
+			name:           "Blank title",
+			payload:        `{"title": "   "}`,
+			expectedErrors: map[string]string{"title": "must not be blank"},
+		},
+		{
+			name:           "Wrong type",
+			payload:        `{"title": "Typed", "completed": "yes"}`,
+			expectedErrors: map[string]string{"completed": "must be a bool"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/user/blog", bytes.NewBufferString(tc.payload))
+			ctx := context.WithValue(req.Context(), middlewares.UserIDKey, uint(1))
+			ctx = context.WithValue(ctx, middlewares.RoleKey, models.RoleAuthor)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			CreateBlog(rr, req)
+
+			if status := rr.Code; status != http.StatusBadRequest {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+			}
+
+			var response struct {
+				Errors map[string]string `json:"errors"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Could not decode response: %v", err)
+			}
+			for field, message := range tc.expectedErrors {
+				if response.Errors[field] != message {
+					t.Errorf("Expected error %q for %v, got %q", message, field, response.Errors[field])
+				}
+			}
+		})
+	}
+}
+
+func TestBlogInputApply(t *testing.T) {
+	blog := models.Blog{Title: "Original", Description: "Original description", UserID: 1}
+	blog.ID = 10
+
+	req := httptest.NewRequest("PUT", "/api/user/blog/10", bytes.NewBufferString(`{"title": "  Updated  ", "completed": true}`))
+	var input blogInput
+	errs, err := decodeStrict(req, &input)
+	if err != nil || errs != nil {
+		t.Fatalf("Expected payload to decode, got %v %v", errs, err)
+	}
+	if errs := input.validate(false); len(errs) > 0 {
+		t.Fatalf("Expected payload to be valid, got %v", errs)
+	}
+	input.apply(&blog)
+
+	if blog.Title != "Updated" || blog.Description != "Original description" || !blog.Completed {
+		t.Errorf("Unexpected blog after update: %+v", blog)
+	}
+	if blog.ID != 10 || blog.UserID != 1 {
+		t.Errorf("Expected ID and owner to be unchanged, got %v and %v", blog.ID, blog.UserID)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestChangePassword(t *testing.T) {
+	setupTestDB(t)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("Password!23"), bcrypt.MinCost)
+	now := time.Now()
+	user := createTestUser(t, models.User{Username: "ChangePasswordUser", Email: "changepassword@example.com", Password: string(hash), EmailVerifiedAt: &now})
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"username": user.Username, "password": password})
+		rr := httptest.NewRecorder()
+		Login(rr, httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body)))
+		return rr
+	}
+
+	// Logging in with a hash made at another cost upgrades it to the configured one
+	rr := login("Password!23")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Login failed with %v: %s", rr.Code, rr.Body.String())
+	}
+	var tokens tokenResponse
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+
+	config.DB.First(&user, user.ID)
+	if cost, _ := bcrypt.Cost([]byte(user.Password)); cost != config.Auth.BcryptCost {
+		t.Errorf("Expected password to be rehashed with cost %v, got %v", config.Auth.BcryptCost, cost)
+	}
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(middlewares.AuthMiddleware)
+	api.HandleFunc("/user/password", ChangePassword).Methods("PUT")
+
+	change := func(token, current, next string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"current_password": current, "new_password": next})
+		req := httptest.NewRequest("PUT", "/api/user/password", bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := change(tokens.Token, "WrongPassword!1", "NewPassword!23"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected wrong current password to be rejected, got %v", rr.Code)
+	}
+	if rr := change(tokens.Token, "Password!23", "short"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected weak new password to be rejected, got %v", rr.Code)
+	}
+
+	pat, prefix, _ := utils.GeneratePersonalAccessToken()
+	config.DB.Create(&models.PersonalAccessToken{UserID: user.ID, Name: "ci", Prefix: prefix, TokenHash: utils.HashToken(pat),
+		Scopes: "blogs:read", ExpiresAt: time.Now().Add(time.Hour)})
+
+	rr = change(tokens.Token, "Password!23", "NewPassword!23")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected password change to succeed, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var fresh tokenResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &fresh); err != nil || fresh.Token == "" {
+		t.Fatalf("Expected fresh tokens, got %s", rr.Body.String())
+	}
+
+	if rr := change(tokens.Token, "NewPassword!23", "OtherPassword!23"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected old access token to be rejected, got %v", rr.Code)
+	}
+	if _, _, err := utils.AuthenticatePersonalAccessToken(pat, time.Now()); err == nil {
+		t.Error("Expected personal access tokens to be deleted")
+	}
+	if rr := login("Password!23"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected old password to be rejected, got %v", rr.Code)
+	}
+	if rr := login("NewPassword!23"); rr.Code != http.StatusOK {
+		t.Errorf("Expected new password to work, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCookieSessions(t *testing.T) {
+	setupTestDB(t)
+
+	previous := config.Auth
+	defer func() { config.Auth = previous }()
+	config.Auth.SessionCookies = true
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("Password!23"), bcrypt.MinCost)
+	now := time.Now()
+	user := createTestUser(t, models.User{Username: "CookieUser", Email: "cookies@example.com", Password: string(hash), EmailVerifiedAt: &now})
+
+	body, _ := json.Marshal(map[string]string{"identifier": user.Username, "password": "Password!23"})
+	req := httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body))
+	req.Header.Set(config.Auth.SessionModeHeader, "cookie")
+	// A CSRF cookie set before the login, perhaps by another site, is replaced
+	req.AddCookie(&http.Cookie{Name: config.Auth.CSRFCookieName, Value: "planted"})
+	rr := httptest.NewRecorder()
+	Login(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Login failed with %v: %s", rr.Code, rr.Body.String())
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if _, leaked := response["token"]; leaked {
+		t.Error("Expected the access token to stay out of the response body")
+	}
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range rr.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	session, refresh, csrf := cookies[config.Auth.SessionCookieName], cookies[config.Auth.RefreshCookieName], cookies[config.Auth.CSRFCookieName]
+	if session == nil || refresh == nil || csrf == nil {
+		t.Fatalf("Expected session, refresh and CSRF cookies, got %v", rr.Result().Cookies())
+	}
+	if !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteLaxMode || !refresh.HttpOnly || csrf.HttpOnly {
+		t.Errorf("Unexpected cookie attributes %+v %+v %+v", session, refresh, csrf)
+	}
+	if response["csrf_token"] != csrf.Value {
+		t.Errorf("Expected the CSRF token in the body to match the cookie")
+	}
+	if csrf.Value == "planted" {
+		t.Error("Expected a new CSRF token on login")
+	}
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(middlewares.AuthMiddleware)
+	api.HandleFunc("/user/sessions", GetSessions).Methods("GET")
+	api.HandleFunc("/logout/all", LogoutAll).Methods("POST")
+	router.HandleFunc("/api/token/refresh", RefreshToken).Methods("POST")
+
+	call := func(method, path, csrfHeader string, sent ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for _, cookie := range sent {
+			req.AddCookie(cookie)
+		}
+		if csrfHeader != "" {
+			req.Header.Set(config.Auth.CSRFHeader, csrfHeader)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := call("GET", "/api/user/sessions", "", session); rr.Code != http.StatusOK {
+		t.Errorf("Expected the cookie to authenticate a GET, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := call("POST", "/api/logout/all", "", session, csrf); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected a POST without a CSRF header to be refused, got %v", rr.Code)
+	}
+	if rr := call("POST", "/api/logout/all", "forged", session, csrf); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected a POST with the wrong CSRF header to be refused, got %v", rr.Code)
+	}
+	if rr := call("POST", "/api/token/refresh", "", refresh, csrf); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected a refresh without a CSRF header to be refused, got %v", rr.Code)
+	}
+
+	rr = call("POST", "/api/token/refresh", csrf.Value, refresh, csrf)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected the refresh cookie to be accepted, got %v: %s", rr.Code, rr.Body.String())
+	}
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == config.Auth.SessionCookieName {
+			session = cookie
+		}
+	}
+
+	rr = call("POST", "/api/logout/all", csrf.Value, session, csrf)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected a POST with the CSRF header to succeed, got %v: %s", rr.Code, rr.Body.String())
+	}
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			t.Errorf("Expected logout to clear cookie %s", cookie.Name)
+		}
+	}
+
+	// Clients that do not ask for cookies still get tokens, which need no CSRF token
+	rr = httptest.NewRecorder()
+	Login(rr, httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body)))
+	var tokens tokenResponse
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+	if tokens.Token == "" || len(rr.Result().Cookies()) != 0 {
+		t.Fatalf("Expected tokens in the body without cookies, got %s %v", rr.Body.String(), rr.Result().Cookies())
+	}
+
+	req = httptest.NewRequest("POST", "/api/logout/all", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.Token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected a bearer token to work alongside cookies, got %v: %s", rr.Code, rr.Body.String())
+	}
+}
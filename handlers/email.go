@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// sendVerificationEmail mails the user a link that confirms their current address
+func sendVerificationEmail(user models.User) error {
+	token, err := utils.GenerateActionToken(utils.PurposeEmailVerification, user, config.Auth.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := config.Mail.BaseURL + "/api/verify-email?token=" + url.QueryEscape(token)
+	return utils.DefaultMailer.Send(utils.Message{
+		To:      user.Email,
+		Subject: "Confirm your Blogsite email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %s. If you did not create a Blogsite account, you can ignore this email.\n",
+			user.Username, link, config.Auth.EmailVerificationTTL),
+	})
+}
+
+// VerifyEmail activates the account named in a verification token. The token is
+// read from the "token" query parameter (links in emails) or a JSON body.
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		var input struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+			http.Error(w, "Verification token is required", http.StatusBadRequest)
+			return
+		}
+		token = input.Token
+	}
+
+	claims, err := utils.ParseActionToken(token, utils.PurposeEmailVerification)
+	if err != nil {
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, claims.UserIDValue()).Error; err != nil {
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+
+	// A token issued for a previous address must not verify the new one
+	if user.Email != claims.Email {
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := config.DB.Model(&user).Update("email_verified_at", time.Now()).Error; err != nil {
+			http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email successfully verified"})
+}
+
+// ResendVerification sends a new verification link. The response is the same
+// whether or not the address belongs to an unverified account, and the email
+// is sent in the background so timing does not tell either. Clients asking
+// too often, or for the same address too often, get 429.
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if emailThrottled(w, r, input.Email) {
+		return
+	}
+
+	go func(email string) {
+		var user models.User
+		if err := config.DB.Where("LOWER(email) = ? AND email_verified_at IS NULL", normalizeEmail(email)).First(&user).Error; err != nil {
+			return
+		}
+		if err := sendVerificationEmail(user); err != nil {
+			log.Printf("Error sending verification email: %v", err)
+		}
+	}(input.Email)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the account exists and is unverified, a verification email has been sent"})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestEmailVerification(t *testing.T) {
+	setupTestDB(t)
+
+	previous := config.Auth
+	defer func() { config.Auth = previous }()
+	config.Auth.RequireEmailVerification = true
+
+	// httptest requests come from 192.0.2.1
+	defer utils.ResetLoginFailures(utils.EmailIPThrottleKey("192.0.2.1"),
+		utils.EmailThrottleKey("verify@example.com"), utils.EmailThrottleKey("nobody-verify@example.com"))
+
+	hash, _ := utils.HashPassword("Password!23")
+	user := createTestUser(t, models.User{Username: "VerifyUser", Email: "verify@example.com", Password: hash})
+
+	mailer := utils.NewMemoryMailer()
+	previousMailer := utils.DefaultMailer
+	utils.DefaultMailer = mailer
+	defer func() { utils.DefaultMailer = previousMailer }()
+
+	login := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"identifier": user.Username, "password": "Password!23"})
+		rr := httptest.NewRecorder()
+		Login(rr, httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body)))
+		return rr
+	}
+	resend := func(email string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"email": email})
+		rr := httptest.NewRecorder()
+		ResendVerification(rr, httptest.NewRequest("POST", "/api/verify-email/resend", bytes.NewBuffer(body)))
+		return rr
+	}
+	verify := func(token string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		VerifyEmail(rr, httptest.NewRequest("GET", "/api/verify-email?token="+url.QueryEscape(token), nil))
+		return rr
+	}
+
+	if rr := login(); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected login to be refused while unverified, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	unknown := resend("nobody-verify@example.com")
+	known := resend("Verify@Example.com")
+	if known.Code != http.StatusAccepted || unknown.Code != known.Code || unknown.Body.String() != known.Body.String() {
+		t.Errorf("Expected identical answers for known and unknown emails, got %v %q and %v %q",
+			known.Code, known.Body.String(), unknown.Code, unknown.Body.String())
+	}
+	messages := waitForMessages(t, mailer, 1)
+	match := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(messages[0].Body)
+	if messages[0].To != user.Email || match == nil {
+		t.Fatalf("Expected a verification link to %s, got %+v", user.Email, messages[0])
+	}
+	token, _ := url.QueryUnescape(match[1])
+
+	t.Run("Rejects forged and expired tokens", func(t *testing.T) {
+		if rr := verify("not-a-token"); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected a forged token to be rejected, got %v", rr.Code)
+		}
+		expired, _ := utils.GenerateActionToken(utils.PurposeEmailVerification, user, -time.Minute)
+		if rr := verify(expired); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected an expired token to be rejected, got %v", rr.Code)
+		}
+		other := user
+		other.Email = "previous-verify@example.com"
+		stale, _ := utils.GenerateActionToken(utils.PurposeEmailVerification, other, time.Hour)
+		if rr := verify(stale); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected a token for another address to be rejected, got %v", rr.Code)
+		}
+
+		var reloaded models.User
+		config.DB.First(&reloaded, user.ID)
+		if reloaded.EmailVerifiedAt != nil {
+			t.Error("Expected the account to stay unverified")
+		}
+	})
+
+	t.Run("Activates the account", func(t *testing.T) {
+		if rr := verify(token); rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var reloaded models.User
+		config.DB.First(&reloaded, user.ID)
+		if reloaded.EmailVerifiedAt == nil {
+			t.Error("Expected the email address to be verified")
+		}
+		if rr := login(); rr.Code != http.StatusOK {
+			t.Errorf("Expected login to succeed once verified, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	middleware "Blogsite/middlewares"
+	"Blogsite/models"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// exportProfile is everything stored about the account itself, apart from
+// secrets such as the password hash and the TOTP seed
+type exportProfile struct {
+	SelfUser
+	EmailVerifiedAt      *time.Time                    `json:"email_verified_at"`
+	TwoFactorEnabled     bool                          `json:"two_factor_enabled"`
+	Passkeys             []PasskeyResponse             `json:"passkeys"`
+	PersonalAccessTokens []PersonalAccessTokenResponse `json:"personal_access_tokens"`
+}
+
+// exportSession also covers sessions that have ended
+type exportSession struct {
+	SessionResponse
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// ExportUserData sends the current user a zip archive of their data, as JSON
+// for machines and Markdown for people
+func ExportUserData(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+	currentID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var (
+		blogs    []models.Blog
+		sessions []models.Session
+		passkeys []models.WebAuthnCredential
+		tokens   []models.PersonalAccessToken
+	)
+	for _, dest := range []interface{}{&blogs, &sessions, &passkeys, &tokens} {
+		if err := config.DB.Where("user_id = ?", user.ID).Order("created_at").Find(dest).Error; err != nil {
+			log.Printf("Error exporting user data: %v", err)
+			http.Error(w, "Failed to export data", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	profile := exportProfile{
+		SelfUser:             newSelfUser(user),
+		EmailVerifiedAt:      user.EmailVerifiedAt,
+		TwoFactorEnabled:     user.TOTPEnabled,
+		Passkeys:             make([]PasskeyResponse, 0, len(passkeys)),
+		PersonalAccessTokens: make([]PersonalAccessTokenResponse, 0, len(tokens)),
+	}
+	for _, cred := range passkeys {
+		profile.Passkeys = append(profile.Passkeys, newPasskeyResponse(cred))
+	}
+	for _, pat := range tokens {
+		profile.PersonalAccessTokens = append(profile.PersonalAccessTokens, newPersonalAccessTokenResponse(pat))
+	}
+	exported := make([]exportSession, 0, len(sessions))
+	for _, session := range sessions {
+		exported = append(exported, exportSession{newSessionResponse(session, currentID), session.RevokedAt})
+	}
+
+	archive, err := buildExportArchive(profile, newBlogResponses(blogs), exported)
+	if err != nil {
+		log.Printf("Error building export archive: %v", err)
+		http.Error(w, "Failed to export data", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("blogsite-export-%s-%s.zip", user.Username, time.Now().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(archive)
+}
+
+// buildExportArchive lays the data out as profile.json, posts.json and
+// sessions.json, with README.md and posts/<id>.md as readable copies
+func buildExportArchive(profile exportProfile, posts []BlogResponse, sessions []exportSession) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", profile},
+		{"posts.json", posts},
+		{"sessions.json", sessions},
+	}
+	for _, file := range files {
+		data, err := json.MarshalIndent(file.content, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := writeZipFile(zw, file.name, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeZipFile(zw, "README.md", []byte(exportReadme(profile, posts, sessions))); err != nil {
+		return nil, err
+	}
+	for _, post := range posts {
+		if err := writeZipFile(zw, fmt.Sprintf("posts/%d.md", post.ID), []byte(postMarkdown(post))); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+func exportReadme(profile exportProfile, posts []BlogResponse, sessions []exportSession) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Blogsite data export for %s\n\n", markdownText(profile.Username))
+	fmt.Fprintf(&b, "Exported %s. The same data is in profile.json, posts.json and sessions.json.\n\n", formatExportTime(time.Now()))
+
+	b.WriteString("## Profile\n\n")
+	fmt.Fprintf(&b, "- Username: %s\n", markdownText(profile.Username))
+	fmt.Fprintf(&b, "- Email: %s\n", markdownText(profile.Email))
+	fmt.Fprintf(&b, "- Role: %s\n", profile.Role)
+	fmt.Fprintf(&b, "- Joined: %s\n", formatExportTime(profile.CreatedAt))
+	if profile.EmailVerifiedAt != nil {
+		fmt.Fprintf(&b, "- Email verified: %s\n", formatExportTime(*profile.EmailVerifiedAt))
+	} else {
+		b.WriteString("- Email verified: no\n")
+	}
+	fmt.Fprintf(&b, "- Two-factor authentication: %s\n", yesNo(profile.TwoFactorEnabled))
+	fmt.Fprintf(&b, "- Passkeys: %d\n", len(profile.Passkeys))
+	fmt.Fprintf(&b, "- Personal access tokens: %d\n", len(profile.PersonalAccessTokens))
+
+	fmt.Fprintf(&b, "\n## Posts (%d)\n\n", len(posts))
+	for _, post := range posts {
+		fmt.Fprintf(&b, "- [%s](posts/%d.md), %s\n", markdownText(post.Title), post.ID, formatExportTime(post.CreatedAt))
+	}
+
+	fmt.Fprintf(&b, "\n## Sessions (%d)\n\n", len(sessions))
+	if len(sessions) > 0 {
+		b.WriteString("| Device | IP address | Started | Last seen | Ended |\n|---|---|---|---|---|\n")
+	}
+	for _, session := range sessions {
+		ended := ""
+		if session.RevokedAt != nil {
+			ended = formatExportTime(*session.RevokedAt)
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", markdownText(session.Device), markdownText(session.IP),
+			formatExportTime(session.CreatedAt), formatExportTime(session.LastSeenAt), ended)
+	}
+	return b.String()
+}
+
+func postMarkdown(post BlogResponse) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", markdownText(post.Title))
+	fmt.Fprintf(&b, "Created %s, last updated %s. Completed: %s.\n\n", formatExportTime(post.CreatedAt),
+		formatExportTime(post.UpdatedAt), yesNo(post.Completed))
+	b.WriteString(post.Description)
+	b.WriteString("\n")
+	return b.String()
+}
+
+// markdownText keeps user-supplied text on one line and out of table syntax
+func markdownText(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ", "|", `\|`, "[", `\[`, "]", `\]`).Replace(s)
+}
+
+func formatExportTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04 UTC")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
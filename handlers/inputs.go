@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"Blogsite/models"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxBlogTitleLength       = 200
+	maxBlogDescriptionLength = 20000
+)
+
+// fieldErrors maps a JSON field name to what is wrong with it
+type fieldErrors map[string]string
+
+// blogInput is the only shape accepted when creating or updating a blog.
+// Omitted fields are left unchanged on update.
+type blogInput struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Completed   *bool   `json:"completed"`
+}
+
+func (in *blogInput) validate(creating bool) fieldErrors {
+	errs := fieldErrors{}
+
+	if in.Title != nil {
+		title := strings.TrimSpace(*in.Title)
+		in.Title = &title
+	}
+	switch {
+	case in.Title == nil && creating:
+		errs["title"] = "is required"
+	case in.Title != nil && *in.Title == "":
+		errs["title"] = "must not be blank"
+	case in.Title != nil && utf8.RuneCountInString(*in.Title) > maxBlogTitleLength:
+		errs["title"] = "must be at most 200 characters"
+	}
+
+	if in.Description != nil && utf8.RuneCountInString(*in.Description) > maxBlogDescriptionLength {
+		errs["description"] = "must be at most 20000 characters"
+	}
+
+	return errs
+}
+
+// apply copies the whitelisted fields onto the blog
+func (in *blogInput) apply(blog *models.Blog) {
+	if in.Title != nil {
+		blog.Title = *in.Title
+	}
+	if in.Description != nil {
+		blog.Description = *in.Description
+	}
+	if in.Completed != nil {
+		blog.Completed = *in.Completed
+	}
+}
+
+// decodeStrict decodes a single JSON object, rejecting fields dst does not declare.
+// Unknown fields are reported as field errors.
+func decodeStrict(r *http.Request, dst interface{}) (fieldErrors, error) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return fieldErrors{strings.Trim(field, `"`): "is not allowed"}, nil
+		}
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return fieldErrors{typeErr.Field: "must be a " + typeErr.Type.String()}, nil
+		}
+		return nil, err
+	}
+	if decoder.Decode(&struct{}{}) != io.EOF {
+		return nil, errors.New("request body must contain a single JSON object")
+	}
+	return nil, nil
+}
+
+func writeFieldErrors(w http.ResponseWriter, errs fieldErrors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Validation failed",
+		"errors":  errs,
+	})
+}
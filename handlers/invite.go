@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	middleware "Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var errInviteInvalid = errors.New("invite code is invalid, used up or expired")
+
+// inviteInput is the body accepted when creating an invite. MaxUses defaults
+// to a single registration and ExpiresInDays to config.Auth.InviteTTL.
+type inviteInput struct {
+	MaxUses       *int `json:"max_uses"`
+	ExpiresInDays *int `json:"expires_in_days"`
+}
+
+func (in *inviteInput) validate() fieldErrors {
+	errs := fieldErrors{}
+
+	if in.MaxUses != nil && (*in.MaxUses < 1 || *in.MaxUses > config.Auth.InviteMaxUses) {
+		errs["max_uses"] = "must be between 1 and " + strconv.Itoa(config.Auth.InviteMaxUses)
+	}
+
+	maxDays := int(config.Auth.InviteMaxTTL / (24 * time.Hour))
+	if in.ExpiresInDays != nil && (*in.ExpiresInDays < 1 || *in.ExpiresInDays > maxDays) {
+		errs["expires_in_days"] = "must be between 1 and " + strconv.Itoa(maxDays)
+	}
+
+	return errs
+}
+
+func (in *inviteInput) maxUses() int {
+	if in.MaxUses == nil {
+		return 1
+	}
+	return *in.MaxUses
+}
+
+func (in *inviteInput) ttl() time.Duration {
+	if in.ExpiresInDays == nil {
+		return config.Auth.InviteTTL
+	}
+	return time.Duration(*in.ExpiresInDays) * 24 * time.Hour
+}
+
+// useInvite counts a registration against an invite inside tx and returns
+// the user who created it. Invites of deleted accounts no longer work.
+func useInvite(tx *gorm.DB, code string) (uint, error) {
+	var invite models.Invite
+	if err := tx.Where("code_hash = ?", utils.HashToken(code)).First(&invite).Error; err != nil {
+		return 0, errInviteInvalid
+	}
+
+	result := tx.Model(&models.Invite{}).
+		Where("id = ? AND uses < max_uses AND expires_at > ?", invite.ID, time.Now()).
+		Where("created_by_id IN (?)", tx.Model(&models.User{}).Select("id")).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, errInviteInvalid
+	}
+	return invite.CreatedByID, nil
+}
+
+// CreateInvite issues an invite code. The code itself is only returned here.
+func CreateInvite(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	var input inviteInput
+	errs, err := decodeStrict(r, &input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if len(errs) == 0 {
+		errs = input.validate()
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, errs)
+		return
+	}
+
+	code, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		http.Error(w, "Error generating invite", http.StatusInternalServerError)
+		return
+	}
+
+	invite := models.Invite{
+		CreatedByID: userID,
+		Prefix:      code[:8],
+		CodeHash:    utils.HashToken(code),
+		MaxUses:     input.maxUses(),
+		ExpiresAt:   time.Now().Add(input.ttl()),
+	}
+	if err := config.DB.Create(&invite).Error; err != nil {
+		http.Error(w, "Failed to create invite", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreatedInvite{
+		InviteResponse: newInviteResponse(invite),
+		Code:           code,
+	})
+}
+
+// GetInvites lists the invites the current user has created
+func GetInvites(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	var invites []models.Invite
+	if err := config.DB.Where("created_by_id = ?", userID).Order("created_at").Find(&invites).Error; err != nil {
+		http.Error(w, "Failed to retrieve invites", http.StatusInternalServerError)
+		return
+	}
+
+	responses := make([]InviteResponse, 0, len(invites))
+	for _, invite := range invites {
+		responses = append(responses, newInviteResponse(invite))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(responses)
+}
+
+// DeleteInvite withdraws one of the current user's invites
+func DeleteInvite(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid invite ID", http.StatusBadRequest)
+		return
+	}
+
+	result := config.DB.Where("id = ? AND created_by_id = ?", id, userID).Delete(&models.Invite{})
+	if result.Error != nil {
+		http.Error(w, "Failed to delete invite", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Invite not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Invite successfully withdrawn"})
+}
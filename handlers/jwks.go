@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"Blogsite/utils"
+	"encoding/json"
+	"net/http"
+)
+
+// JWKS publishes the public keys that verify Blogsite access tokens
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string][]utils.JWK{"keys": utils.PublicJWKs()})
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"Blogsite/utils/ldaptest"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestLDAPLogin(t *testing.T) {
+	setupTestDB(t)
+
+	server := ldaptest.NewServer(
+		ldaptest.Entry{DN: "cn=blogsite,ou=services,dc=example,dc=com", Password: "service-secret"},
+		ldaptest.Entry{DN: "uid=ldapwriter,ou=people,dc=example,dc=com", Password: "Directory-Pass-1", Attributes: map[string][]string{
+			"uid":      {"ldapwriter"},
+			"mail":     {"LDAPWriter@example.com"},
+			"memberOf": {"cn=writers,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"},
+		}},
+		ldaptest.Entry{DN: "uid=ldapguest,ou=people,dc=example,dc=com", Password: "Directory-Pass-2", Attributes: map[string][]string{
+			"uid":  {"ldapguest"},
+			"mail": {"ldapguest@example.com"},
+		}},
+		ldaptest.Entry{DN: "uid=ldap.odd,ou=people,dc=example,dc=com", Password: "Directory-Pass-4", Attributes: map[string][]string{
+			"uid":      {"ldap.odd@example.com"},
+			"mail":     {"ldapodd@example.com"},
+			"memberOf": {"cn=writers,ou=groups,dc=example,dc=com"},
+		}},
+		ldaptest.Entry{DN: "uid=ldaplocal,ou=people,dc=example,dc=com", Password: "Directory-Pass-3", Attributes: map[string][]string{
+			"uid":      {"ldaplocal"},
+			"mail":     {"ldaplocal-dir@example.com"},
+			"memberOf": {"cn=writers,ou=groups,dc=example,dc=com"},
+		}},
+	)
+	defer server.Close()
+
+	previous := config.LDAP
+	defer func() { config.LDAP = previous }()
+	config.LDAP = config.LDAPConfig{
+		URL:               server.URL,
+		Timeout:           5 * time.Second,
+		BindDN:            "cn=blogsite,ou=services,dc=example,dc=com",
+		BindPassword:      "service-secret",
+		BaseDN:            "ou=people,dc=example,dc=com",
+		UserFilter:        "(uid={username})",
+		UsernameAttribute: "uid",
+		EmailAttribute:    "mail",
+		GroupAttribute:    "memberOf",
+		AuthorGroup:       "cn=writers,ou=groups,dc=example,dc=com",
+	}
+
+	purgeTestUsers(t, "ldapwriter@example.com", "ldapguest@example.com", "ldapodd@example.com", "ldaplocal@example.com")
+
+	login := func(identifier, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"identifier": identifier, "password": password})
+		rr := httptest.NewRecorder()
+		Login(rr, httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body)))
+		return rr
+	}
+
+	t.Run("Provisions directory users", func(t *testing.T) {
+		if rr := login("ldapwriter", "Directory-Pass-1"); rr.Code != http.StatusOK {
+			t.Fatalf("Expected login to succeed, got %v: %s", rr.Code, rr.Body.String())
+		}
+		var user models.User
+		if err := config.DB.Where("username = ?", "ldapwriter").First(&user).Error; err != nil {
+			t.Fatalf("Expected the user to be provisioned: %v", err)
+		}
+		if user.AuthSource != models.AuthSourceLDAP || user.ExternalID != "uid=ldapwriter,ou=people,dc=example,dc=com" ||
+			user.Email != "ldapwriter@example.com" || user.Role != models.RoleAuthor || user.EmailVerifiedAt == nil {
+			t.Errorf("Unexpected provisioned user %+v", user)
+		}
+
+		if rr := login("ldapwriter", "Wrong-Pass-1"); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a wrong password to be rejected, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Syncs roles from groups", func(t *testing.T) {
+		config.LDAP.EditorGroup = "cn=staff,ou=groups,dc=example,dc=com"
+		defer func() { config.LDAP.EditorGroup = "" }()
+
+		var before models.User
+		config.DB.Where("username = ?", "ldapwriter").First(&before)
+
+		if rr := login("ldapwriter@example.com", "Directory-Pass-1"); rr.Code != http.StatusOK {
+			t.Fatalf("Expected login by email to succeed, got %v: %s", rr.Code, rr.Body.String())
+		}
+		var after models.User
+		config.DB.First(&after, before.ID)
+		if after.Role != models.RoleEditor {
+			t.Errorf("Expected the role to follow the directory groups, got %s", after.Role)
+		}
+		if after.TokenVersion == before.TokenVersion {
+			t.Error("Expected a role change to invalidate earlier tokens")
+		}
+	})
+
+	t.Run("Matches known users by DN", func(t *testing.T) {
+		var user models.User
+		config.DB.Where("username = ?", "ldapwriter").First(&user)
+
+		body, _ := json.Marshal(map[string]string{"username": "ldapguest"})
+		id := strconv.Itoa(int(user.ID))
+		req := mux.SetURLVars(httptest.NewRequest("PUT", "/api/user/"+id, bytes.NewBuffer(body)), map[string]string{"id": id})
+		ctx := context.WithValue(req.Context(), middlewares.UserIDKey, user.ID)
+		ctx = context.WithValue(ctx, middlewares.RoleKey, user.Role)
+		rr := httptest.NewRecorder()
+		UpdateUser(rr, req.WithContext(ctx))
+		if rr.Code != http.StatusConflict {
+			t.Errorf("Expected directory users not to be renamed, got %v: %s", rr.Code, rr.Body.String())
+		}
+
+		// Even if the name changes, another directory user's password does not open the account
+		config.DB.Model(&user).Update("username", "ldapguest")
+		defer config.DB.Model(&user).Update("username", "ldapwriter")
+		if rr := login("ldapguest", "Directory-Pass-2"); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the login to be checked against the recorded DN, got %v", rr.Code)
+		}
+		if rr := login("ldapguest", "Directory-Pass-1"); rr.Code != http.StatusOK {
+			t.Errorf("Expected the DN's own password to keep working, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Refuses users without a mapped group", func(t *testing.T) {
+		if rr := login("ldapguest", "Directory-Pass-2"); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected a user in no mapped group to be refused, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Refuses usernames Blogsite would not accept", func(t *testing.T) {
+		config.LDAP.UserFilter = "(|(uid={username})(mail={username}))"
+		defer func() { config.LDAP.UserFilter = "(uid={username})" }()
+
+		if rr := login("ldapodd@example.com", "Directory-Pass-4"); rr.Code != http.StatusConflict {
+			t.Errorf("Expected an invalid directory username to be refused, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Never takes over local accounts", func(t *testing.T) {
+		hash, _ := utils.HashPassword("Local-Pass-123")
+		local := models.User{Username: "ldaplocal", Email: "ldaplocal@example.com", Password: hash, EmailVerifiedAt: new(time.Time)}
+		config.DB.Create(&local)
+
+		if rr := login("ldaplocal", "Directory-Pass-3"); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the directory password not to open a local account, got %v", rr.Code)
+		}
+		if rr := login("ldaplocal", "Local-Pass-123"); rr.Code != http.StatusOK {
+			t.Errorf("Expected the local password to keep working, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+}
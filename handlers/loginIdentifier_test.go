@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginIdentifier(t *testing.T) {
+	setupTestDB(t)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("Password!23"), bcrypt.MinCost)
+	now := time.Now()
+	createTestUser(t, models.User{Username: "IdentifierUser", Email: "identifier@example.com", Password: string(hash), EmailVerifiedAt: &now})
+
+	tests := []struct {
+		name           string
+		payload        map[string]string
+		expectedStatus int
+	}{
+		{"Username", map[string]string{"identifier": "IdentifierUser", "password": "Password!23"}, http.StatusOK},
+		{"Username in another case", map[string]string{"identifier": "identifieruser", "password": "Password!23"}, http.StatusOK},
+		{"Email in another case", map[string]string{"identifier": "Identifier@Example.com", "password": "Password!23"}, http.StatusOK},
+		{"Legacy username field", map[string]string{"username": "IdentifierUser", "password": "Password!23"}, http.StatusOK},
+		{"Wrong password", map[string]string{"identifier": "identifier@example.com", "password": "WrongPassword!23"}, http.StatusUnauthorized},
+		{"Unknown identifier", map[string]string{"identifier": "nobody@example.com", "password": "Password!23"}, http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(tc.payload)
+			rr := httptest.NewRecorder()
+			Login(rr, httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body)))
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("Expected status %v, got %v: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRegisterNormalizesEmail(t *testing.T) {
+	setupTestDB(t)
+
+	purgeTestUsers(t, "casevariant@example.com")
+
+	register := func(username, email string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"username": username, "email": email, "password": "Tulip-Marble-42"})
+		rr := httptest.NewRecorder()
+		Register(rr, httptest.NewRequest("POST", "/api/register", bytes.NewBuffer(body)))
+		return rr
+	}
+
+	if rr := register("CaseVariant", "  CaseVariant@Example.COM "); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected registration to succeed, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var user models.User
+	if err := config.DB.Where("username = ?", "CaseVariant").First(&user).Error; err != nil {
+		t.Fatalf("Failed to load registered user: %v", err)
+	}
+	if user.Email != "casevariant@example.com" {
+		t.Errorf("Expected email to be stored lowercased, got %q", user.Email)
+	}
+
+	if rr := register("CaseVariantTwo", "casevariant@example.com"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected duplicate email to be rejected, got %v", rr.Code)
+	}
+	if rr := register("casevariant", "other@example.com"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected username differing only in case to be rejected, got %v", rr.Code)
+	}
+
+	// The index catches variants written without going through Register
+	variant := models.User{Username: "CaseVariantRaw", Email: "CaseVariant@example.com", Password: "HashedPassword!23"}
+	if err := config.DB.Create(&variant).Error; err == nil {
+		config.DB.Unscoped().Delete(&variant)
+		t.Error("Expected the unique index to reject an email differing only in case")
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginLockout(t *testing.T) {
+	setupTestDB(t)
+
+	previous := config.Auth
+	config.Auth.LoginMaxAccountFailures = 2
+	config.Auth.LoginMaxIPFailures = 100
+	defer func() { config.Auth = previous }()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("Password!23"), bcrypt.MinCost)
+	now := time.Now()
+	user := createTestUser(t, models.User{Username: "LockoutUser", Email: "lockout@example.com", Password: string(hash), EmailVerifiedAt: &now})
+
+	const remoteAddr = "192.0.2.44:40000"
+	defer utils.ResetLoginFailures(utils.AccountThrottleKey(user.ID), utils.IPThrottleKey("192.0.2.44"))
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"username": user.Username, "password": password})
+		req := httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body))
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		Login(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := login("WrongPassword!23"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected status %v, got %v", i+1, http.StatusUnauthorized, rr.Code)
+		}
+	}
+
+	// Locked out now, even with the right password
+	rr := login("Password!23")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %v, got %v", http.StatusTooManyRequests, rr.Code)
+	}
+	retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After"))
+	if err != nil || retryAfter <= 0 || retryAfter > int(config.Auth.LoginLockoutBase.Seconds()) {
+		t.Errorf("Unexpected Retry-After %q", rr.Header().Get("Retry-After"))
+	}
+
+	unlock := httptest.NewRequest("DELETE", "/api/admin/users/"+strconv.Itoa(int(user.ID))+"/lockout", nil)
+	unlock = mux.SetURLVars(unlock, map[string]string{"id": strconv.Itoa(int(user.ID))})
+	unlockRR := httptest.NewRecorder()
+	UnlockUser(unlockRR, unlock)
+	if unlockRR.Code != http.StatusOK {
+		t.Fatalf("Expected unlock to succeed, got %v", unlockRR.Code)
+	}
+
+	if rr := login("Password!23"); rr.Code != http.StatusOK {
+		t.Errorf("Expected login after unlock to succeed, got %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestEmailThrottle(t *testing.T) {
+	setupTestDB(t)
+
+	previous := config.Auth
+	config.Auth.EmailMaxAddressRequests = 2
+	config.Auth.EmailMaxIPRequests = 3
+	config.Auth.MagicLinkEnabled = true
+	defer func() { config.Auth = previous }()
+
+	endpoints := map[string]http.HandlerFunc{
+		"/api/verify-email/resend": ResendVerification,
+		"/api/password/forgot":     ForgotPassword,
+		"/api/login/magic":         RequestMagicLink,
+	}
+	for path, handler := range endpoints {
+		t.Run(path, func(t *testing.T) {
+			const ip = "192.0.2.46"
+			emails := []string{"throttled-a@example.com", "throttled-b@example.com", "throttled-c@example.com"}
+			keys := []string{utils.EmailIPThrottleKey(ip)}
+			for _, email := range emails {
+				keys = append(keys, utils.EmailThrottleKey(email))
+			}
+			utils.ResetLoginFailures(keys...)
+			defer utils.ResetLoginFailures(keys...)
+
+			request := func(email string) *httptest.ResponseRecorder {
+				body, _ := json.Marshal(map[string]string{"email": email})
+				req := httptest.NewRequest("POST", path, bytes.NewBuffer(body))
+				req.RemoteAddr = ip + ":40000"
+				rr := httptest.NewRecorder()
+				handler(rr, req)
+				return rr
+			}
+			expectThrottled := func(rr *httptest.ResponseRecorder) {
+				t.Helper()
+				if rr.Code != http.StatusTooManyRequests {
+					t.Fatalf("Expected status %v, got %v: %s", http.StatusTooManyRequests, rr.Code, rr.Body.String())
+				}
+				if retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || retryAfter <= 0 {
+					t.Errorf("Unexpected Retry-After %q", rr.Header().Get("Retry-After"))
+				}
+			}
+
+			// Two emails per address, whatever the case of the request
+			for _, email := range []string{emails[0], "Throttled-A@Example.com"} {
+				if rr := request(email); rr.Code != http.StatusAccepted {
+					t.Fatalf("Expected status %v, got %v: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+				}
+			}
+			expectThrottled(request(emails[0]))
+
+			// Three requests per client, counting only those that were let through
+			if rr := request(emails[1]); rr.Code != http.StatusAccepted {
+				t.Fatalf("Expected status %v, got %v: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+			}
+			expectThrottled(request(emails[2]))
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestMagicLinkLogin(t *testing.T) {
+	setupTestDB(t)
+
+	user := createTestUser(t, models.User{Username: "MagicLinkUser", Email: "magiclink@example.com", Password: "HashedPassword!23"})
+
+	mailer := utils.NewMemoryMailer()
+	previousMailer := utils.DefaultMailer
+	utils.DefaultMailer = mailer
+	defer func() { utils.DefaultMailer = previousMailer }()
+
+	if err := sendMagicLink(user); err != nil {
+		t.Fatalf("Failed to send magic link: %v", err)
+	}
+	messages := mailer.Messages()
+	if len(messages) != 1 || messages[0].To != user.Email {
+		t.Fatalf("Expected one email to %s, got %+v", user.Email, messages)
+	}
+	match := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(messages[0].Body)
+	if match == nil {
+		t.Fatalf("No token in email body: %s", messages[0].Body)
+	}
+	token, _ := url.QueryUnescape(match[1])
+
+	exchange := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"token": token})
+		rr := httptest.NewRecorder()
+		MagicLinkLogin(rr, httptest.NewRequest("POST", "/api/login/magic/verify", bytes.NewBuffer(body)))
+		return rr
+	}
+
+	rr := exchange()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var tokens tokenResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &tokens); err != nil || tokens.Token == "" {
+		t.Fatalf("Expected an access token, got %s", rr.Body.String())
+	}
+	if _, err := utils.ParseJWT(tokens.Token); err != nil {
+		t.Errorf("Issued access token does not verify: %v", err)
+	}
+
+	var reloaded models.User
+	config.DB.First(&reloaded, user.ID)
+	if reloaded.EmailVerifiedAt == nil {
+		t.Errorf("Expected following the link to verify the email address")
+	}
+
+	if rr := exchange(); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a reused link to be rejected, got %v", rr.Code)
+	}
+
+	expired, err := utils.GenerateActionToken(utils.PurposeMagicLink, user, -time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	token = expired
+	if rr := exchange(); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an expired link to be rejected, got %v", rr.Code)
+	}
+
+	// Directory users log in with their directory password only
+	directoryUser := createTestUser(t, models.User{Username: "MagicLinkLDAPUser", Email: "magicldap@example.com",
+		AuthSource: models.AuthSourceLDAP, ExternalID: "uid=magicldap,ou=people,dc=example,dc=com"})
+	if token, err = utils.GenerateActionToken(utils.PurposeMagicLink, directoryUser, time.Minute); err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if rr := exchange(); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a directory user's link to be rejected, got %v", rr.Code)
+	}
+
+	config.Auth.MagicLinkEnabled = false
+	defer func() { config.Auth.MagicLinkEnabled = true }()
+	if rr := exchange(); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected magic links to be unavailable when disabled, got %v", rr.Code)
+	}
+}
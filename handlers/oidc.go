@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+const maxOIDCUsernameLength = 32
+
+// Reasons an OIDC login is turned away after the provider vouched for the user
+var (
+	errOIDCNotLinked     = errors.New("no account is linked to this identity")
+	errOIDCEmailConflict = errors.New("an account with this email already exists")
+	errOIDCNoEmail       = errors.New("the identity provider did not share a verified email address")
+	// errOIDCSecondFactor keeps a provider login from skipping the second factor
+	// an existing account is protected by
+	errOIDCSecondFactor = errors.New("the account with this email uses two-factor authentication")
+	// errOIDCExternalAccount keeps the provider from opening accounts whose
+	// logins the directory or a trusted proxy decides
+	errOIDCExternalAccount = errors.New("the account with this email logs in through the directory or a proxy")
+)
+
+func oidcClient() utils.OIDCClient {
+	return utils.OIDCClient{
+		Issuer:       config.Auth.OIDCIssuer,
+		ClientID:     config.Auth.OIDCClientID,
+		ClientSecret: config.Auth.OIDCClientSecret,
+		RedirectURL:  config.Auth.OIDCRedirectURL,
+		Scopes:       config.Auth.OIDCScopes,
+	}
+}
+
+// BeginOIDCLogin returns the provider URL to send the browser to, along with
+// a state token the client keeps until the provider redirects back
+func BeginOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if !config.Auth.OIDCEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	client := oidcClient()
+	provider, err := client.Provider(r.Context())
+	if err != nil {
+		log.Printf("Error discovering OIDC provider: %v", err)
+		http.Error(w, "Identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		if secrets[i], err = utils.GenerateOpaqueToken(); err != nil {
+			http.Error(w, "Error generating state", http.StatusInternalServerError)
+			return
+		}
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	// The nonce and verifier stay on the server; the client only learns the
+	// state, which the provider sends back anyway
+	if err := utils.SaveOIDCLogin(state, nonce, verifier, config.Auth.OIDCLoginTTL); err != nil {
+		log.Printf("Error saving OIDC login: %v", err)
+		http.Error(w, "Error generating state", http.StatusInternalServerError)
+		return
+	}
+	token, err := utils.GenerateChallengeToken(utils.PurposeOIDCLogin, 0, state, config.Auth.OIDCLoginTTL)
+	if err != nil {
+		http.Error(w, "Error generating state", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"authorization_url": client.AuthCodeURL(provider, state, nonce, verifier),
+		"state_token":       token,
+		"expires_in":        int64(config.Auth.OIDCLoginTTL.Seconds()),
+	})
+}
+
+// FinishOIDCLogin redeems the code the provider sent back and answers like
+// Login, including the two-factor challenge for users who enabled it
+func FinishOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if !config.Auth.OIDCEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	var input struct {
+		StateToken string `json:"state_token"`
+		State      string `json:"state"`
+		Code       string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.StateToken == "" || input.Code == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := consumeActionToken(input.StateToken, utils.PurposeOIDCLogin)
+	if err != nil || subtle.ConstantTimeCompare([]byte(claims.Challenge), []byte(input.State)) != 1 {
+		http.Error(w, "Invalid or expired login state", http.StatusUnauthorized)
+		return
+	}
+
+	nonce, verifier, err := utils.RedeemOIDCLogin(claims.Challenge, time.Now())
+	if errors.Is(err, utils.ErrOIDC) {
+		http.Error(w, "Invalid or expired login state", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error redeeming OIDC login: %v", err)
+		http.Error(w, "Login with the identity provider failed", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := oidcLogin(r.Context(), nonce, verifier, input.Code)
+	if err == nil {
+		completeLogin(w, r, user)
+		return
+	}
+
+	switch {
+	case errors.Is(err, errOIDCNotLinked), errors.Is(err, errOIDCNoEmail), errors.Is(err, errOIDCExternalAccount):
+		http.Error(w, "Single sign-on is not available for this account: "+err.Error(), http.StatusForbidden)
+	case errors.Is(err, errOIDCEmailConflict):
+		http.Error(w, "An account with this email already exists; verify its email address before logging in with single sign-on", http.StatusConflict)
+	case errors.Is(err, errOIDCSecondFactor):
+		http.Error(w, "An account with this email uses two-factor authentication or passkeys and cannot be linked to single sign-on", http.StatusConflict)
+	case errors.Is(err, utils.ErrOIDC):
+		log.Printf("OIDC login rejected: %v", err)
+		http.Error(w, "Login with the identity provider failed", http.StatusUnauthorized)
+	default:
+		log.Printf("Error completing OIDC login: %v", err)
+		http.Error(w, "Login with the identity provider failed", http.StatusBadGateway)
+	}
+}
+
+// oidcLogin redeems the authorization code and returns the user the
+// provider's ID token stands for
+func oidcLogin(ctx context.Context, nonce, codeVerifier, code string) (models.User, error) {
+	client := oidcClient()
+	provider, err := client.Provider(ctx)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	rawIDToken, err := client.Exchange(ctx, provider, code, codeVerifier)
+	if err != nil {
+		return models.User{}, err
+	}
+	idToken, err := client.VerifyIDToken(ctx, provider, rawIDToken, nonce, time.Now())
+	if err != nil {
+		return models.User{}, err
+	}
+	return oidcUser(provider.Issuer, idToken)
+}
+
+// oidcUser finds the user an ID token stands for. A known identity logs into
+// its user; otherwise an account with the same verified email is linked, and
+// failing that a new account is provisioned.
+func oidcUser(issuer string, claims *utils.IDTokenClaims) (models.User, error) {
+	var user models.User
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		email := normalizeEmail(claims.Email)
+
+		var identity models.OIDCIdentity
+		err := tx.Where("issuer = ? AND subject = ?", issuer, claims.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return errOIDCNotLinked
+			}
+			if !hasLocalPassword(user) {
+				return errOIDCExternalAccount
+			}
+			return tx.Model(&identity).Updates(map[string]interface{}{"email": email, "last_login_at": now}).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Linking and provisioning both go by the email, which only counts once
+		// the provider has verified it
+		if !claims.EmailVerified || !isValidEmail(email) {
+			return errOIDCNoEmail
+		}
+
+		err = tx.Where("LOWER(email) = ?", email).First(&user).Error
+		switch {
+		case err == nil:
+			// The local account must have confirmed the address too, or whoever
+			// registered it first could take over the provider's user
+			if user.EmailVerifiedAt == nil {
+				return errOIDCEmailConflict
+			}
+			if !hasLocalPassword(user) {
+				return errOIDCExternalAccount
+			}
+			if protected, err := hasSecondFactor(tx, user); err != nil {
+				return err
+			} else if protected {
+				return errOIDCSecondFactor
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// An invite-only site has no invite to redeem here, so new users
+			// must register with one before linking the provider
+			if !config.Auth.OIDCAutoProvision || config.Auth.RegistrationMode == config.RegistrationInvite {
+				return errOIDCNotLinked
+			}
+			if user, err = provisionOIDCUser(tx, email, claims); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&models.OIDCIdentity{
+			UserID:      user.ID,
+			Issuer:      issuer,
+			Subject:     claims.Subject,
+			Email:       email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	return user, err
+}
+
+// hasSecondFactor reports whether logging in to user takes more than a
+// password, with a TOTP code or a passkey
+func hasSecondFactor(tx *gorm.DB, user models.User) (bool, error) {
+	if user.TOTPEnabled {
+		return true, nil
+	}
+	var passkeys int64
+	err := tx.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&passkeys).Error
+	return passkeys > 0, err
+}
+
+// provisionOIDCUser creates an account for someone logging in through the
+// provider for the first time. It has no password until one is set through
+// the password reset flow.
+func provisionOIDCUser(tx *gorm.DB, email string, claims *utils.IDTokenClaims) (models.User, error) {
+	username, err := oidcUsername(tx, claims.PreferredUsername, strings.SplitN(email, "@", 2)[0], claims.Name)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	now := time.Now()
+	user := models.User{Username: username, Email: email, EmailVerifiedAt: &now}
+	if config.Auth.RegistrationMode == config.RegistrationApproval {
+		user.Status = models.StatusPending
+	}
+
+	if err := tx.Create(&user).Error; err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// oidcUsername turns the first usable candidate into a free username that
+// passes validateUsername, adding a number when it is taken
+func oidcUsername(tx *gorm.DB, candidates ...string) (string, error) {
+	base := ""
+	for _, candidate := range candidates {
+		base = strings.Map(func(r rune) rune {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return r
+			}
+			return -1
+		}, candidate)
+		if base != "" {
+			break
+		}
+	}
+	if len(base) < 6 {
+		base += "user"
+	}
+	if len(base) > maxOIDCUsernameLength-4 {
+		base = base[:maxOIDCUsernameLength-4]
+	}
+
+	for i := 1; i < 1000; i++ {
+		username := base
+		if i > 1 || len(username) < 6 {
+			username = base + strconv.Itoa(i)
+		}
+
+		var taken int64
+		if err := tx.Model(&models.User{}).Unscoped().Where("LOWER(username) = LOWER(?)", username).Count(&taken).Error; err != nil {
+			return "", err
+		}
+		if taken == 0 {
+			return username, nil
+		}
+	}
+	return "", errors.New("no free username for OIDC user")
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// mockOIDCProvider is a minimal identity provider. Authorize stands in for the
+// user logging in at the provider and returns the code it redirects back with.
+type mockOIDCProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	codes  map[string]url.Values
+	// Claims are put into the ID token issued for the next code
+	Claims jwt.MapClaims
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	p := &mockOIDCProvider{t: t, key: key, codes: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		params, ok := p.codes[r.FormValue("code")]
+		delete(p.codes, r.FormValue("code"))
+		id, secret, _ := r.BasicAuth()
+		if !ok || id != config.Auth.OIDCClientID || secret != config.Auth.OIDCClientSecret ||
+			r.FormValue("redirect_uri") != params.Get("redirect_uri") ||
+			utils.PKCEChallenge(r.FormValue("code_verifier")) != params.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   p.server.URL,
+			"aud":   config.Auth.OIDCClientID,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": params.Get("nonce"),
+		}
+		for k, v := range p.Claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "mock"
+		idToken, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+	return p
+}
+
+func (p *mockOIDCProvider) Authorize(authorizationURL string) (state, code string) {
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		p.t.Fatalf("Invalid authorization URL %q", authorizationURL)
+	}
+	params := u.Query()
+	if params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "" {
+		p.t.Fatalf("Expected a PKCE challenge in %q", authorizationURL)
+	}
+	code = "code-" + params.Get("state")[:8]
+	p.codes[code] = params
+	return params.Get("state"), code
+}
+
+func TestOIDCLogin(t *testing.T) {
+	setupTestDB(t)
+
+	provider := newMockOIDCProvider(t)
+	previous := config.Auth
+	defer func() { config.Auth = previous }()
+	config.Auth.OIDCIssuer = provider.server.URL
+	config.Auth.OIDCClientID = "blogsite"
+	config.Auth.OIDCClientSecret = "s3cret"
+	config.Auth.OIDCAutoProvision = true
+	config.Auth.RegistrationMode = config.RegistrationOpen
+
+	purgeTestUsers(t, "sso.person@example.com", "ssolinked@example.com", "ssounverified@example.com", "sso2fa@example.com", "ssopasskey@example.com", "ssoinvite@example.com", "ssoproxy@example.com")
+
+	login := func(state func(string) string) *httptest.ResponseRecorder {
+		begin := httptest.NewRecorder()
+		BeginOIDCLogin(begin, httptest.NewRequest("POST", "/api/login/oidc/begin", nil))
+		if begin.Code != http.StatusOK {
+			t.Fatalf("Expected begin to succeed, got %v: %s", begin.Code, begin.Body.String())
+		}
+		var started struct {
+			AuthorizationURL string `json:"authorization_url"`
+			StateToken       string `json:"state_token"`
+		}
+		json.Unmarshal(begin.Body.Bytes(), &started)
+
+		returnedState, code := provider.Authorize(started.AuthorizationURL)
+		body, _ := json.Marshal(map[string]string{"state_token": started.StateToken, "state": state(returnedState), "code": code})
+		rr := httptest.NewRecorder()
+		FinishOIDCLogin(rr, httptest.NewRequest("POST", "/api/login/oidc/finish", bytes.NewBuffer(body)))
+		return rr
+	}
+	sameState := func(s string) string { return s }
+
+	t.Run("Provisions a new user", func(t *testing.T) {
+		provider.Claims = jwt.MapClaims{"sub": "sso-1", "email": "SSO.Person@example.com", "email_verified": true, "preferred_username": "sso.person"}
+
+		rr := login(sameState)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected login to succeed, got %v: %s", rr.Code, rr.Body.String())
+		}
+		var tokens tokenResponse
+		json.Unmarshal(rr.Body.Bytes(), &tokens)
+		if tokens.Token == "" || tokens.RefreshToken == "" {
+			t.Errorf("Expected Blogsite tokens, got %s", rr.Body.String())
+		}
+
+		var user models.User
+		if err := config.DB.Where("email = ?", "sso.person@example.com").First(&user).Error; err != nil {
+			t.Fatalf("Expected the user to be provisioned: %v", err)
+		}
+		if user.Username != "ssoperson" || user.EmailVerifiedAt == nil {
+			t.Errorf("Unexpected provisioned user %+v", user)
+		}
+
+		// The second login finds the same user by the linked identity
+		if rr := login(sameState); rr.Code != http.StatusOK {
+			t.Fatalf("Expected the second login to succeed, got %v", rr.Code)
+		}
+		var count int64
+		config.DB.Model(&models.User{}).Where("email = ?", "sso.person@example.com").Count(&count)
+		if count != 1 {
+			t.Errorf("Expected one user, got %d", count)
+		}
+	})
+
+	t.Run("Links an account by verified email", func(t *testing.T) {
+		now := time.Now()
+		existing := models.User{Username: "SSOLinkedUser", Email: "ssolinked@example.com", Password: "HashedPassword!23", EmailVerifiedAt: &now}
+		config.DB.Create(&existing)
+
+		provider.Claims = jwt.MapClaims{"sub": "sso-2", "email": "ssolinked@example.com", "email_verified": true}
+		if rr := login(sameState); rr.Code != http.StatusOK {
+			t.Fatalf("Expected login to succeed, got %v: %s", rr.Code, rr.Body.String())
+		}
+		var identity models.OIDCIdentity
+		if err := config.DB.Where("subject = ?", "sso-2").First(&identity).Error; err != nil || identity.UserID != existing.ID {
+			t.Errorf("Expected the identity to be linked to user %d, got %+v", existing.ID, identity)
+		}
+	})
+
+	t.Run("Refuses to link an unverified account", func(t *testing.T) {
+		existing := models.User{Username: "SSOUnverifiedUser", Email: "ssounverified@example.com", Password: "HashedPassword!23"}
+		config.DB.Create(&existing)
+
+		provider.Claims = jwt.MapClaims{"sub": "sso-3", "email": "ssounverified@example.com", "email_verified": true}
+		if rr := login(sameState); rr.Code != http.StatusConflict {
+			t.Errorf("Expected a conflict, got %v: %s", rr.Code, rr.Body.String())
+		}
+
+		provider.Claims = jwt.MapClaims{"sub": "sso-4", "email": "ssounverified@example.com", "email_verified": false}
+		if rr := login(sameState); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected an unverified provider email to be refused, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Refuses to link an account with a second factor", func(t *testing.T) {
+		now := time.Now()
+		totp := models.User{Username: "SSOTwoFactorUser", Email: "sso2fa@example.com", Password: "HashedPassword!23", EmailVerifiedAt: &now, TOTPEnabled: true}
+		config.DB.Create(&totp)
+		provider.Claims = jwt.MapClaims{"sub": "sso-5", "email": "sso2fa@example.com", "email_verified": true}
+		if rr := login(sameState); rr.Code != http.StatusConflict {
+			t.Errorf("Expected an account with TOTP not to be linked, got %v: %s", rr.Code, rr.Body.String())
+		}
+
+		passkey := models.User{Username: "SSOPasskeyUser", Email: "ssopasskey@example.com", Password: "HashedPassword!23", EmailVerifiedAt: &now}
+		config.DB.Create(&passkey)
+		config.DB.Create(&models.WebAuthnCredential{UserID: passkey.ID, Name: "laptop", CredentialID: "sso-passkey-credential", PublicKey: []byte{1}})
+		provider.Claims = jwt.MapClaims{"sub": "sso-6", "email": "ssopasskey@example.com", "email_verified": true}
+		if rr := login(sameState); rr.Code != http.StatusConflict {
+			t.Errorf("Expected an account with a passkey not to be linked, got %v: %s", rr.Code, rr.Body.String())
+		}
+
+		var linked int64
+		config.DB.Model(&models.OIDCIdentity{}).Where("subject IN ?", []string{"sso-5", "sso-6"}).Count(&linked)
+		if linked != 0 {
+			t.Errorf("Expected no identities to be linked, got %d", linked)
+		}
+	})
+
+	t.Run("Refuses to link directory and proxy accounts", func(t *testing.T) {
+		now := time.Now()
+		proxied := models.User{Username: "SSOProxyUser", Email: "ssoproxy@example.com", EmailVerifiedAt: &now,
+			AuthSource: models.AuthSourceProxy, ExternalID: "SSOProxyUser"}
+		config.DB.Create(&proxied)
+
+		provider.Claims = jwt.MapClaims{"sub": "sso-8", "email": "ssoproxy@example.com", "email_verified": true}
+		if rr := login(sameState); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected a proxy account not to be linked, got %v: %s", rr.Code, rr.Body.String())
+		}
+		var linked int64
+		config.DB.Model(&models.OIDCIdentity{}).Where("subject = ?", "sso-8").Count(&linked)
+		if linked != 0 {
+			t.Errorf("Expected no identity to be linked, got %d", linked)
+		}
+	})
+
+	t.Run("Does not provision users without an invite", func(t *testing.T) {
+		config.Auth.RegistrationMode = config.RegistrationInvite
+		defer func() { config.Auth.RegistrationMode = config.RegistrationOpen }()
+
+		provider.Claims = jwt.MapClaims{"sub": "sso-7", "email": "ssoinvite@example.com", "email_verified": true}
+		if rr := login(sameState); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected a new user to be refused while registration is invite-only, got %v: %s", rr.Code, rr.Body.String())
+		}
+		var count int64
+		config.DB.Model(&models.User{}).Where("email = ?", "ssoinvite@example.com", "ssoproxy@example.com").Count(&count)
+		if count != 0 {
+			t.Errorf("Expected no account to be created, got %d", count)
+		}
+
+		// Users who already have an account still log in
+		provider.Claims = jwt.MapClaims{"sub": "sso-1", "email": "sso.person@example.com", "email_verified": true}
+		if rr := login(sameState); rr.Code != http.StatusOK {
+			t.Errorf("Expected a linked user to log in, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Asks linked users for their second factor", func(t *testing.T) {
+		config.DB.Model(&models.User{}).Where("email = ?", "sso.person@example.com").Update("totp_enabled", true)
+		defer config.DB.Model(&models.User{}).Where("email = ?", "sso.person@example.com").Update("totp_enabled", false)
+
+		provider.Claims = jwt.MapClaims{"sub": "sso-1", "email": "sso.person@example.com", "email_verified": true}
+		rr := login(sameState)
+		var response struct {
+			Token             string `json:"token"`
+			TwoFactorRequired bool   `json:"two_factor_required"`
+			ChallengeToken    string `json:"challenge_token"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if rr.Code != http.StatusOK || !response.TwoFactorRequired || response.ChallengeToken == "" || response.Token != "" {
+			t.Errorf("Expected a two-factor challenge instead of tokens, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Keeps the nonce and PKCE verifier on the server", func(t *testing.T) {
+		begin := httptest.NewRecorder()
+		BeginOIDCLogin(begin, httptest.NewRequest("POST", "/api/login/oidc/begin", nil))
+		var started struct {
+			AuthorizationURL string `json:"authorization_url"`
+			StateToken       string `json:"state_token"`
+		}
+		json.Unmarshal(begin.Body.Bytes(), &started)
+		u, _ := url.Parse(started.AuthorizationURL)
+		params := u.Query()
+
+		parts := strings.Split(started.StateToken, ".")
+		if len(parts) != 3 {
+			t.Fatalf("Expected a JWT state token, got %q", started.StateToken)
+		}
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if strings.Contains(string(payload), params.Get("nonce")) || strings.Contains(string(payload), "code_verifier") {
+			t.Errorf("Expected the state token not to carry the login's secrets, got %s", payload)
+		}
+
+		var saved models.OIDCLogin
+		if err := config.DB.Where("state_hash = ?", utils.HashToken(params.Get("state"))).First(&saved).Error; err != nil {
+			t.Fatalf("Expected the login to be saved: %v", err)
+		}
+		if saved.Nonce != params.Get("nonce") || utils.PKCEChallenge(saved.CodeVerifier) != params.Get("code_challenge") {
+			t.Errorf("Expected the saved login to match the authorization URL, got %+v", saved)
+		}
+	})
+
+	t.Run("Rejects a mismatched state", func(t *testing.T) {
+		provider.Claims = jwt.MapClaims{"sub": "sso-1", "email": "sso.person@example.com", "email_verified": true}
+		rr := login(func(string) string { return "forged" })
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a forged state to be rejected, got %v", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBeginPasskeyLogin(t *testing.T) {
+	setupTestDB(t)
+
+	hash, _ := utils.HashPassword("Password!23")
+	withPasskey := createTestUser(t, models.User{Username: "PasskeyUser", Email: "passkey@example.com", Password: hash})
+	withoutPasskey := createTestUser(t, models.User{Username: "NoPasskeyUser", Email: "nopasskey@example.com", Password: hash})
+	if err := config.DB.Create(&models.WebAuthnCredential{UserID: withPasskey.ID, Name: "laptop",
+		CredentialID: "cGFzc2tleS1sb2dpbi10ZXN0", PublicKey: []byte{1}}).Error; err != nil {
+		t.Fatalf("Failed to create passkey: %v", err)
+	}
+
+	type options struct {
+		ChallengeToken string `json:"challenge_token"`
+		PublicKey      struct {
+			AllowCredentials []credentialDescriptor `json:"allowCredentials"`
+		} `json:"publicKey"`
+	}
+	begin := func(username string) options {
+		body, _ := json.Marshal(map[string]string{"username": username})
+		rr := httptest.NewRecorder()
+		BeginPasskeyLogin(rr, httptest.NewRequest("POST", "/api/login/passkey/begin", bytes.NewBuffer(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var response options
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return response
+	}
+
+	t.Run("Offers the user's passkeys", func(t *testing.T) {
+		allowed := begin(withPasskey.Username).PublicKey.AllowCredentials
+		if len(allowed) != 1 || allowed[0].ID != "cGFzc2tleS1sb2dpbi10ZXN0" {
+			t.Errorf("Expected the user's passkey to be offered, got %+v", allowed)
+		}
+	})
+
+	t.Run("Does not tell whether an account exists", func(t *testing.T) {
+		for _, username := range []string{"NobodyPasskey", withoutPasskey.Username} {
+			first, second := begin(username), begin(username)
+			allowed := first.PublicKey.AllowCredentials
+			if len(allowed) != 1 || allowed[0].Type != "public-key" || allowed[0].ID == "" {
+				t.Errorf("Expected one made-up passkey for %s, got %+v", username, allowed)
+				continue
+			}
+			if again := second.PublicKey.AllowCredentials; len(again) != 1 || again[0].ID != allowed[0].ID {
+				t.Errorf("Expected the same made-up passkey on every attempt for %s, got %+v and %+v", username, allowed, again)
+			}
+		}
+		if begin("NobodyPasskey").PublicKey.AllowCredentials[0].ID == begin("SomebodyElse").PublicKey.AllowCredentials[0].ID {
+			t.Error("Expected different usernames to get different made-up passkeys")
+		}
+	})
+
+	t.Run("Does not put the user in the challenge token", func(t *testing.T) {
+		for _, username := range []string{withPasskey.Username, "NobodyPasskey"} {
+			claims, err := utils.ParseActionToken(begin(username).ChallengeToken, utils.PurposeWebAuthnAuthentication)
+			if err != nil {
+				t.Fatalf("Expected a valid challenge token: %v", err)
+			}
+			if claims.UserIDValue() != 0 {
+				t.Errorf("Expected no user in the challenge token for %s, got %d", username, claims.UserIDValue())
+			}
+		}
+	})
+}
+
+func TestBeginPasskeyRegistration(t *testing.T) {
+	setupTestDB(t)
+
+	hash, _ := utils.HashPassword("Password!23")
+	local := createTestUser(t, models.User{Username: "PasskeyLocalUser", Email: "passkeylocal@example.com", Password: hash})
+	directory := createTestUser(t, models.User{Username: "PasskeyLDAPUser", Email: "passkeyldap@example.com",
+		AuthSource: models.AuthSourceLDAP, ExternalID: "uid=passkeyldap,ou=people,dc=example,dc=com"})
+
+	begin := func(user models.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/user/passkeys/register/begin", nil)
+		req = req.WithContext(context.WithValue(req.Context(), middlewares.UserIDKey, user.ID))
+		rr := httptest.NewRecorder()
+		BeginPasskeyRegistration(rr, req)
+		return rr
+	}
+
+	if rr := begin(local); rr.Code != http.StatusOK {
+		t.Errorf("Expected a local user to register a passkey, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := begin(directory); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected a directory user to be refused, got %v: %s", rr.Code, rr.Body.String())
+	}
+}
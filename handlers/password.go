@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	middleware "Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errResetTokenInvalid = errors.New("invalid reset token")
+
+// sendPasswordResetEmail creates a reset token for the user and mails it.
+// Earlier unused tokens are invalidated so only the latest link works.
+func sendPasswordResetEmail(user models.User) error {
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: now.Add(config.Auth.PasswordResetTTL),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := config.Mail.BaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	return utils.DefaultMailer.Send(utils.Message{
+		To:      user.Email,
+		Subject: "Reset your Blogsite password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your Blogsite account. "+
+			"To choose a new password, open the link below:\n\n%s\n\n"+
+			"The link expires in %s and can only be used once. If you did not ask for this, you can ignore this email.\n",
+			user.Username, link, config.Auth.PasswordResetTTL),
+	})
+}
+
+// ForgotPassword mails a reset link. The response never reveals whether an
+// account exists, and the email is sent in the background so timing does not either.
+// Like ResendVerification, it is throttled per client and per address.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if emailThrottled(w, r, input.Email) {
+		return
+	}
+
+	go func(email string) {
+		var user models.User
+		if err := config.DB.Where("LOWER(email) = ?", normalizeEmail(email)).First(&user).Error; err != nil || !hasLocalPassword(user) {
+			return
+		}
+		if err := sendPasswordResetEmail(user); err != nil {
+			log.Printf("Error sending password reset email: %v", err)
+		}
+	}(input.Email)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If an account with that email exists, a password reset link has been sent"})
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword, signs
+// the user out of every existing session and deletes their personal access tokens
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var revokedTokens int64
+	err := utils.Transaction(config.DB, func(tx *gorm.DB) error {
+		var reset models.PasswordResetToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(input.Token)).
+			First(&reset).Error
+		if err != nil || reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+			return errResetTokenInvalid
+		}
+
+		var user models.User
+		if err := tx.First(&user, reset.UserID).Error; err != nil || !hasLocalPassword(user) {
+			return errResetTokenInvalid
+		}
+
+		// Rejecting the password rolls back and leaves the token usable
+		if err := validatePassword(input.Password, user.Username, user.Email); err != nil {
+			return err
+		}
+		hashedPassword, err := utils.HashPassword(input.Password)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&reset).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		// Following the emailed link also proves ownership of the address
+		updates := map[string]interface{}{"password": hashedPassword}
+		if user.EmailVerifiedAt == nil {
+			updates["email_verified_at"] = now
+		}
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		revokedTokens, err = revokeAllCredentials(tx, user.ID)
+		return err
+	})
+	if errors.Is(err, errResetTokenInvalid) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+	var policyErr passwordPolicyError
+	if errors.As(err, &policyErr) {
+		writePasswordError(w, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Error resetting password: %v", err)
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":                        "Password successfully reset",
+		"revoked_personal_access_tokens": revokedTokens,
+	})
+}
+
+// rehashPassword upgrades a stored hash made with outdated settings while the
+// plaintext is at hand. Failing to do so is logged but does not fail the login.
+func rehashPassword(user models.User, password string) {
+	if !utils.PasswordNeedsRehash(user.Password) {
+		return
+	}
+	hashed, err := utils.HashPassword(password)
+	if err == nil {
+		// Guarded by the old hash so a concurrent password change is not overwritten
+		err = config.DB.Model(&models.User{}).
+			Where("id = ? AND password = ?", user.ID, user.Password).
+			Update("password", hashed).Error
+	}
+	if err != nil {
+		log.Printf("Error upgrading password hash for user %d: %v", user.ID, err)
+	}
+}
+
+// ChangePassword sets a new password for the current user. Every session is
+// signed out, personal access tokens are deleted and the caller receives a
+// fresh token pair.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if !hasLocalPassword(user) {
+		http.Error(w, "Your password is managed by your directory and cannot be changed here", http.StatusConflict)
+		return
+	}
+
+	// A stolen access token must not allow guessing the password without limit
+	if loginThrottled(w, utils.AccountThrottleKey(user.ID)) {
+		return
+	}
+	if err := utils.CheckPassword(user.Password, input.CurrentPassword); err != nil {
+		recordLoginFailure(r, user.ID)
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	if err := validatePassword(input.NewPassword, user.Username, user.Email); err != nil {
+		writePasswordError(w, err)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		return
+	}
+
+	err = utils.Transaction(config.DB, func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", hashedPassword).Error; err != nil {
+			return err
+		}
+		_, err := revokeAllCredentials(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error changing password: %v", err)
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	// The version bump above invalidated the caller's token too
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	respondWithTokens(w, r, user)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// waitForMessages waits for mail sent in the background
+func waitForMessages(t *testing.T, mailer *utils.MemoryMailer, n int) []utils.Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if messages := mailer.Messages(); len(messages) >= n {
+			return messages
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d emails, got %+v", n, mailer.Messages())
+	return nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	setupTestDB(t)
+
+	hash, _ := utils.HashPassword("Old-Password!23")
+	now := time.Now()
+	user := createTestUser(t, models.User{Username: "ResetUser", Email: "reset@example.com", Password: hash, EmailVerifiedAt: &now})
+
+	mailer := utils.NewMemoryMailer()
+	previousMailer := utils.DefaultMailer
+	utils.DefaultMailer = mailer
+	defer func() { utils.DefaultMailer = previousMailer }()
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(middlewares.AuthMiddleware)
+	api.HandleFunc("/user/blogs", GetUserBlogs).Methods("GET")
+	router.HandleFunc("/api/token/refresh", RefreshToken).Methods("POST")
+	router.HandleFunc("/api/password/forgot", ForgotPassword).Methods("POST")
+	router.HandleFunc("/api/password/reset", ResetPassword).Methods("POST")
+
+	call := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	reset := func(token, password string) *httptest.ResponseRecorder {
+		return call("POST", "/api/password/reset", "", map[string]string{"token": token, "password": password})
+	}
+
+	body, _ := json.Marshal(map[string]string{"username": user.Username, "password": "Old-Password!23"})
+	rr := httptest.NewRecorder()
+	Login(rr, httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body)))
+	var session tokenResponse
+	json.Unmarshal(rr.Body.Bytes(), &session)
+
+	pat, prefix, _ := utils.GeneratePersonalAccessToken()
+	config.DB.Create(&models.PersonalAccessToken{UserID: user.ID, Name: "ci", Prefix: prefix, TokenHash: utils.HashToken(pat),
+		Scopes: "blogs:read", ExpiresAt: time.Now().Add(time.Hour)})
+
+	unknown := call("POST", "/api/password/forgot", "", map[string]string{"email": "nobody-reset@example.com"})
+	known := call("POST", "/api/password/forgot", "", map[string]string{"email": "Reset@Example.com"})
+	if known.Code != http.StatusAccepted || unknown.Code != known.Code || unknown.Body.String() != known.Body.String() {
+		t.Errorf("Expected identical answers for known and unknown emails, got %v %q and %v %q",
+			known.Code, known.Body.String(), unknown.Code, unknown.Body.String())
+	}
+
+	messages := waitForMessages(t, mailer, 1)
+	for _, message := range messages {
+		if message.To != user.Email {
+			t.Errorf("Expected no email to an unknown address, got one to %s", message.To)
+		}
+	}
+	match := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(messages[0].Body)
+	if match == nil {
+		t.Fatalf("No token in email body: %s", messages[0].Body)
+	}
+	token, _ := url.QueryUnescape(match[1])
+
+	t.Run("Rejects passwords that fail the policy", func(t *testing.T) {
+		rr := reset(token, "password")
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "does not meet the requirements") {
+			t.Errorf("Expected a weak password to be rejected, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Resets the password once", func(t *testing.T) {
+		rr := reset(token, "New-Password!45")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var response struct {
+			RevokedTokens int64 `json:"revoked_personal_access_tokens"`
+		}
+		if json.Unmarshal(rr.Body.Bytes(), &response); response.RevokedTokens != 1 {
+			t.Errorf("Expected one personal access token to be reported revoked, got %s", rr.Body.String())
+		}
+		var reloaded models.User
+		config.DB.First(&reloaded, user.ID)
+		if utils.CheckPassword(reloaded.Password, "New-Password!45") != nil {
+			t.Error("Expected the new password to be set")
+		}
+
+		if rr := reset(token, "Another-Password!67"); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected a used token to be rejected, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Signs out existing sessions and tokens", func(t *testing.T) {
+		if _, _, err := utils.AuthenticatePersonalAccessToken(pat, time.Now()); err == nil {
+			t.Error("Expected personal access tokens to be deleted")
+		}
+		if rr := call("GET", "/api/user/blogs", session.Token, nil); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the old access token to be refused, got %v", rr.Code)
+		}
+		if rr := call("POST", "/api/token/refresh", "", map[string]string{"refresh_token": session.RefreshToken}); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the old refresh token to be refused, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Rejects expired tokens", func(t *testing.T) {
+		expired, _ := utils.GenerateOpaqueToken()
+		config.DB.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(expired),
+			ExpiresAt: time.Now().Add(-time.Minute),
+		})
+		if rr := reset(expired, "Expired-Password!89"); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected an expired token to be rejected, got %v", rr.Code)
+		}
+		if rr := reset("forged-token", "Forged-Password!89"); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected an unknown token to be rejected, got %v", rr.Code)
+		}
+	})
+}
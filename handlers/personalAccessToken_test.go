@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPersonalAccessTokens(t *testing.T) {
+	setupTestDB(t)
+
+	user := createTestUser(t, models.User{Username: "PATUser", Email: "pat@example.com", Password: "HashedPassword!23", Role: models.RoleAuthor})
+
+	create := func(payload map[string]interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/api/user/tokens", bytes.NewBuffer(body))
+		req = req.WithContext(context.WithValue(req.Context(), middlewares.UserIDKey, user.ID))
+		rr := httptest.NewRecorder()
+		CreatePersonalAccessToken(rr, req)
+		return rr
+	}
+
+	if rr := create(map[string]interface{}{"name": "ci", "scopes": []string{"blogs:delete-everything"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected unknown scope to be rejected, got %v", rr.Code)
+	}
+
+	rr := create(map[string]interface{}{"name": "ci", "scopes": []string{"blogs:read"}, "expires_in_days": 30})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var created CreatedPersonalAccessToken
+	json.Unmarshal(rr.Body.Bytes(), &created)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	call := func(token string, perm models.Permission) int {
+		req := httptest.NewRequest("GET", "/api/feed", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		middlewares.AuthMiddleware(middlewares.RequirePermission(perm)(ok)).ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := call(created.Token, models.PermBlogsRead); code != http.StatusOK {
+		t.Errorf("Expected token to read blogs, got %v", code)
+	}
+	if code := call(created.Token, models.PermBlogsCreate); code != http.StatusForbidden {
+		t.Errorf("Expected token without blogs:write to be refused, got %v", code)
+	}
+	if code := call(created.Token+"x", models.PermBlogsRead); code != http.StatusUnauthorized {
+		t.Errorf("Expected unknown token to be rejected, got %v", code)
+	}
+
+	var stored models.PersonalAccessToken
+	config.DB.First(&stored, created.ID)
+	if stored.LastUsedAt == nil {
+		t.Errorf("Expected last use to be recorded")
+	}
+	if stored.TokenHash == created.Token {
+		t.Errorf("Expected the token to be stored hashed")
+	}
+
+	config.DB.Delete(&stored)
+	if code := call(created.Token, models.PermBlogsRead); code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked token to be rejected, got %v", code)
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	middleware "Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+const maxTokenNameLength = 64
+
+// personalAccessTokenInput is the body accepted when creating a token.
+// ExpiresInDays defaults to config.Auth.PersonalAccessTokenTTL.
+type personalAccessTokenInput struct {
+	Name          string         `json:"name"`
+	Scopes        []models.Scope `json:"scopes"`
+	ExpiresInDays *int           `json:"expires_in_days"`
+}
+
+func (in *personalAccessTokenInput) validate() fieldErrors {
+	errs := fieldErrors{}
+
+	in.Name = strings.TrimSpace(in.Name)
+	switch {
+	case in.Name == "":
+		errs["name"] = "is required"
+	case utf8.RuneCountInString(in.Name) > maxTokenNameLength:
+		errs["name"] = "must be at most 64 characters"
+	}
+
+	if len(in.Scopes) == 0 {
+		errs["scopes"] = "must name at least one scope"
+	}
+	seen := map[models.Scope]bool{}
+	for _, s := range in.Scopes {
+		if !s.Valid() {
+			errs["scopes"] = "contains unknown scope " + strconv.Quote(string(s))
+			break
+		}
+		if seen[s] {
+			errs["scopes"] = "contains " + strconv.Quote(string(s)) + " more than once"
+			break
+		}
+		seen[s] = true
+	}
+
+	maxDays := int(config.Auth.PersonalAccessTokenMaxTTL / (24 * time.Hour))
+	if in.ExpiresInDays != nil && (*in.ExpiresInDays < 1 || *in.ExpiresInDays > maxDays) {
+		errs["expires_in_days"] = "must be between 1 and " + strconv.Itoa(maxDays)
+	}
+
+	return errs
+}
+
+func (in *personalAccessTokenInput) ttl() time.Duration {
+	if in.ExpiresInDays == nil {
+		return config.Auth.PersonalAccessTokenTTL
+	}
+	return time.Duration(*in.ExpiresInDays) * 24 * time.Hour
+}
+
+// CreatePersonalAccessToken issues a new token. The token itself is only
+// returned here; afterwards only its prefix is shown.
+func CreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	var input personalAccessTokenInput
+	errs, err := decodeStrict(r, &input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if len(errs) == 0 {
+		errs = input.validate()
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, errs)
+		return
+	}
+
+	token, prefix, err := utils.GeneratePersonalAccessToken()
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	pat := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      input.Name,
+		Prefix:    prefix,
+		TokenHash: utils.HashToken(token),
+		Scopes:    models.JoinScopes(input.Scopes),
+		ExpiresAt: time.Now().Add(input.ttl()),
+	}
+	if err := config.DB.Create(&pat).Error; err != nil {
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreatedPersonalAccessToken{
+		PersonalAccessTokenResponse: newPersonalAccessTokenResponse(pat),
+		Token:                       token,
+	})
+}
+
+// GetPersonalAccessTokens lists the current user's tokens
+func GetPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	var pats []models.PersonalAccessToken
+	if err := config.DB.Where("user_id = ?", userID).Order("created_at").Find(&pats).Error; err != nil {
+		http.Error(w, "Failed to retrieve tokens", http.StatusInternalServerError)
+		return
+	}
+
+	responses := make([]PersonalAccessTokenResponse, 0, len(pats))
+	for _, pat := range pats {
+		responses = append(responses, newPersonalAccessTokenResponse(pat))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(responses)
+}
+
+// DeletePersonalAccessToken revokes one of the current user's tokens
+func DeletePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	result := config.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.PersonalAccessToken{})
+	if result.Error != nil {
+		http.Error(w, "Failed to delete token", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Token successfully revoked"})
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyAuth(t *testing.T) {
+	setupTestDB(t)
+
+	previous := config.Auth
+	defer func() { config.Auth = previous }()
+	_, gateway, _ := net.ParseCIDR("10.0.0.0/24")
+	config.Auth.ProxyAuthTrustedProxies = []*net.IPNet{gateway}
+	config.Auth.ProxyAuthUserHeader = "X-Forwarded-User"
+	config.Auth.ProxyAuthEmailHeader = "X-Forwarded-Email"
+	config.Auth.ProxyAuthAutoProvision = true
+	config.Auth.RegistrationMode = config.RegistrationOpen
+
+	purgeTestUsers(t, "proxynew@example.com", "proxypending@example.com")
+	existing := createTestUser(t, models.User{Username: "ProxyExisting", Email: "proxyexisting@example.com", Role: models.RoleEditor,
+		AuthSource: models.AuthSourceProxy, ExternalID: "ProxyExisting"})
+	createTestUser(t, models.User{Username: "ProxyLocal", Email: "proxylocal@example.com", Password: "HashedPassword!23", Role: models.RoleAdmin})
+
+	handler := middlewares.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%v %v", r.Context().Value(middlewares.UserIDKey), middlewares.RoleFromContext(r.Context()))
+	}))
+	request := func(remoteAddr, username, email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/user/sessions", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-User", username)
+		req.Header.Set("X-Forwarded-Email", email)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Looks up existing users", func(t *testing.T) {
+		rr := request("10.0.0.7:41000", "proxyexisting", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if want := fmt.Sprintf("%d %s", existing.ID, models.RoleEditor); rr.Body.String() != want {
+			t.Errorf("Expected %q, got %q", want, rr.Body.String())
+		}
+	})
+
+	t.Run("Never hands over other accounts", func(t *testing.T) {
+		if rr := request("10.0.0.7:41000", "proxylocal", "proxylocal@example.com"); rr.Code != http.StatusConflict {
+			t.Errorf("Expected a local account's username to be refused, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Ignores headers from untrusted clients", func(t *testing.T) {
+		if rr := request("192.0.2.1:41000", "ProxyExisting", "proxyexisting@example.com"); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected forged headers to be ignored, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Provisions new users", func(t *testing.T) {
+		if rr := request("10.0.0.7:41000", "ProxyNew", ""); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected a new user without an email to be refused, got %v", rr.Code)
+		}
+		if rr := request("10.0.0.7:41000", "ProxyNew", "ProxyNew@Example.com"); rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var user models.User
+		if err := config.DB.Where("username = ?", "ProxyNew").First(&user).Error; err != nil {
+			t.Fatalf("Expected the user to be created: %v", err)
+		}
+		if user.Email != "proxynew@example.com" || user.AuthSource != models.AuthSourceProxy || user.ExternalID != "ProxyNew" || user.EmailVerifiedAt == nil {
+			t.Errorf("Unexpected provisioned user %+v", user)
+		}
+
+		if rr := request("10.0.0.7:41000", "ProxyOther", "proxyexisting@example.com"); rr.Code != http.StatusConflict {
+			t.Errorf("Expected a taken email to be refused, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Holds new users for approval", func(t *testing.T) {
+		config.Auth.RegistrationMode = config.RegistrationApproval
+		defer func() { config.Auth.RegistrationMode = config.RegistrationOpen }()
+
+		if rr := request("10.0.0.7:41000", "ProxyPending", "proxypending@example.com"); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected a pending user to be refused, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Refuses unknown users without auto-provisioning", func(t *testing.T) {
+		config.Auth.ProxyAuthAutoProvision = false
+		defer func() { config.Auth.ProxyAuthAutoProvision = true }()
+
+		if rr := request("10.0.0.7:41000", "ProxyStranger", "proxystranger@example.com"); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected an unknown user to be refused, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Deletes accounts without a password", func(t *testing.T) {
+		leaving := createTestUser(t, models.User{Username: "ProxyLeaving", Email: "proxyleaving@example.com",
+			AuthSource: models.AuthSourceProxy, ExternalID: "ProxyLeaving"})
+
+		req := httptest.NewRequest("DELETE", "/api/user", nil)
+		req.RemoteAddr = "10.0.0.7:41000"
+		req.Header.Set("X-Forwarded-User", "ProxyLeaving")
+		rr := httptest.NewRecorder()
+		middlewares.AuthMiddleware(http.HandlerFunc(DeleteAccount)).ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected deletion to succeed, got %v: %s", rr.Code, rr.Body.String())
+		}
+		if err := config.DB.First(&models.User{}, leaving.ID).Error; err == nil {
+			t.Error("Expected the user to be hidden after deletion")
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRefreshToken(t *testing.T) {
+	setupTestDB(t)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("Password!23"), bcrypt.MinCost)
+	now := time.Now()
+	user := createTestUser(t, models.User{Username: "RefreshUser", Email: "refresh@example.com", Password: string(hash), EmailVerifiedAt: &now})
+
+	login := func() tokenResponse {
+		body, _ := json.Marshal(map[string]string{"username": user.Username, "password": "Password!23"})
+		rr := httptest.NewRecorder()
+		Login(rr, httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Login failed with %v: %s", rr.Code, rr.Body.String())
+		}
+		var tokens tokenResponse
+		json.Unmarshal(rr.Body.Bytes(), &tokens)
+		return tokens
+	}
+	refresh := func(refreshToken string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+		rr := httptest.NewRecorder()
+		RefreshToken(rr, httptest.NewRequest("POST", "/api/token/refresh", bytes.NewBuffer(body)))
+		return rr
+	}
+	stored := func(refreshToken string) models.RefreshToken {
+		var record models.RefreshToken
+		if err := config.DB.Where("token_hash = ?", utils.HashToken(refreshToken)).First(&record).Error; err != nil {
+			t.Fatalf("Expected the refresh token to be stored: %v", err)
+		}
+		return record
+	}
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(middlewares.AuthMiddleware)
+	api.HandleFunc("/user/blogs", GetUserBlogs).Methods("GET")
+	authorized := func(token string) bool {
+		req := httptest.NewRequest("GET", "/api/user/blogs", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code == http.StatusOK
+	}
+
+	first := login()
+
+	t.Run("Rotates the token pair", func(t *testing.T) {
+		rr := refresh(first.RefreshToken)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var second tokenResponse
+		json.Unmarshal(rr.Body.Bytes(), &second)
+		if second.Token == "" || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+			t.Fatalf("Expected a new token pair, got %+v", second)
+		}
+		if stored(first.RefreshToken).UsedAt == nil {
+			t.Error("Expected the old refresh token to be marked used")
+		}
+		if next := stored(second.RefreshToken); next.UsedAt != nil || next.FamilyID != stored(first.RefreshToken).FamilyID {
+			t.Errorf("Expected the new refresh token to continue the family, got %+v", next)
+		}
+		if !authorized(second.Token) {
+			t.Error("Expected the new access token to be accepted")
+		}
+
+		t.Run("Revokes the family when a used token is replayed", func(t *testing.T) {
+			if rr := refresh(first.RefreshToken); rr.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected status %v, got %v: %s", http.StatusUnauthorized, rr.Code, rr.Body.String())
+			}
+			if rr := refresh(second.RefreshToken); rr.Code != http.StatusUnauthorized {
+				t.Errorf("Expected the descendant refresh token to be revoked, got %v", rr.Code)
+			}
+			if authorized(second.Token) {
+				t.Error("Expected the descendant access token to be refused")
+			}
+		})
+	})
+
+	t.Run("Rejects expired tokens", func(t *testing.T) {
+		tokens := login()
+		config.DB.Model(&models.RefreshToken{}).
+			Where("token_hash = ?", utils.HashToken(tokens.RefreshToken)).
+			Update("expires_at", time.Now().Add(-time.Minute))
+
+		if rr := refresh(tokens.RefreshToken); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %v, got %v: %s", http.StatusUnauthorized, rr.Code, rr.Body.String())
+		}
+		if stored(tokens.RefreshToken).UsedAt != nil {
+			t.Error("Expected an expired token not to be rotated")
+		}
+	})
+
+	t.Run("Rejects unknown tokens", func(t *testing.T) {
+		if rr := refresh("not-a-refresh-token"); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %v, got %v", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRegistrationModes(t *testing.T) {
+	setupTestDB(t)
+
+	purgeTestUsers(t, "invitee@example.com", "invitee2@example.com", "pending@example.com")
+	defer func(mode config.RegistrationMode, verify bool) {
+		config.Auth.RegistrationMode = mode
+		config.Auth.RequireEmailVerification = verify
+	}(config.Auth.RegistrationMode, config.Auth.RequireEmailVerification)
+	config.Auth.RequireEmailVerification = false
+
+	inviter := createTestUser(t, models.User{Username: "InviterUser", Email: "inviter@example.com", Password: "HashedPassword!23", Role: models.RoleReader})
+
+	register := func(username, email, inviteCode string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"username": username, "email": email, "password": "Tulip-Marble-42", "invite_code": inviteCode})
+		rr := httptest.NewRecorder()
+		Register(rr, httptest.NewRequest("POST", "/api/register", bytes.NewBuffer(body)))
+		return rr
+	}
+
+	t.Run("Invite only", func(t *testing.T) {
+		config.Auth.RegistrationMode = config.RegistrationInvite
+
+		if rr := register("InviteeUser", "invitee@example.com", ""); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected registration without an invite to be refused, got %v", rr.Code)
+		}
+
+		body := bytes.NewBufferString(`{"max_uses": 1, "expires_in_days": 2}`)
+		req := httptest.NewRequest("POST", "/api/user/invites", body)
+		req = req.WithContext(context.WithValue(req.Context(), middlewares.UserIDKey, inviter.ID))
+		rr := httptest.NewRecorder()
+		CreateInvite(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected invite to be created, got %v: %s", rr.Code, rr.Body.String())
+		}
+		var invite CreatedInvite
+		json.Unmarshal(rr.Body.Bytes(), &invite)
+
+		if rr := register("InviteeUser", "invitee@example.com", invite.Code+"x"); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected an unknown invite to be refused, got %v", rr.Code)
+		}
+		if rr := register("InviteeUser", "invitee@example.com", invite.Code); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected registration with an invite to succeed, got %v: %s", rr.Code, rr.Body.String())
+		}
+		var invitee models.User
+		config.DB.Where("email = ?", "invitee@example.com").First(&invitee)
+		if invitee.InvitedByID == nil || *invitee.InvitedByID != inviter.ID {
+			t.Errorf("Expected the invitee to record who invited them, got %v", invitee.InvitedByID)
+		}
+
+		if rr := register("InviteeTwo", "invitee2@example.com", invite.Code); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected a used-up invite to be refused, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Admin approval", func(t *testing.T) {
+		config.Auth.RegistrationMode = config.RegistrationApproval
+
+		rr := register("PendingUser", "pending@example.com", "")
+		if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), "approve") {
+			t.Fatalf("Expected a pending registration, got %v: %s", rr.Code, rr.Body.String())
+		}
+
+		login := func() *httptest.ResponseRecorder {
+			body, _ := json.Marshal(map[string]string{"identifier": "pending@example.com", "password": "Tulip-Marble-42"})
+			rr := httptest.NewRecorder()
+			Login(rr, httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body)))
+			return rr
+		}
+		if rr := login(); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "awaiting approval") {
+			t.Errorf("Expected a pending account to be refused, got %v: %s", rr.Code, rr.Body.String())
+		}
+
+		var pending models.User
+		config.DB.Where("email = ?", "pending@example.com").First(&pending)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/api/admin/users/{id}/approve", ApproveUser).Methods("POST")
+		approve := httptest.NewRecorder()
+		router.ServeHTTP(approve, httptest.NewRequest("POST", "/api/admin/users/"+strconv.Itoa(int(pending.ID))+"/approve", nil))
+		if approve.Code != http.StatusOK {
+			t.Fatalf("Expected approval to succeed, got %v: %s", approve.Code, approve.Body.String())
+		}
+
+		if rr := login(); rr.Code != http.StatusOK {
+			t.Errorf("Expected an approved account to log in, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"Blogsite/models"
+	"time"
+)
+
+// PublicUser is the profile any authenticated caller may see
+type PublicUser struct {
+	ID        uint      `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SelfUser is the view of a user's own account
+type SelfUser struct {
+	PublicUser
+	Email     string      `json:"email"`
+	Role      models.Role `json:"role"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// AdminUser is the view of an account for admins
+type AdminUser struct {
+	SelfUser
+	Status       models.UserStatus `json:"status"`
+	TokenVersion uint              `json:"token_version"`
+}
+
+// BlogResponse is the wire format of a blog post
+type BlogResponse struct {
+	ID          uint      `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Completed   bool      `json:"completed"`
+	UserID      uint      `json:"user_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PasskeyResponse describes a registered passkey without its key material
+type PasskeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// PersonalAccessTokenResponse describes a personal access token without the secret
+type PersonalAccessTokenResponse struct {
+	ID         uint           `json:"id"`
+	Name       string         `json:"name"`
+	Prefix     string         `json:"prefix"`
+	Scopes     []models.Scope `json:"scopes"`
+	CreatedAt  time.Time      `json:"created_at"`
+	ExpiresAt  time.Time      `json:"expires_at"`
+	LastUsedAt *time.Time     `json:"last_used_at"`
+}
+
+// CreatedPersonalAccessToken is returned once, when the token is created
+type CreatedPersonalAccessToken struct {
+	PersonalAccessTokenResponse
+	Token string `json:"token"`
+}
+
+// InviteResponse describes an invite without its code
+type InviteResponse struct {
+	ID        uint      `json:"id"`
+	Prefix    string    `json:"prefix"`
+	MaxUses   int       `json:"max_uses"`
+	Uses      int       `json:"uses"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreatedInvite is returned once, when the invite is created
+type CreatedInvite struct {
+	InviteResponse
+	Code string `json:"code"`
+}
+
+// SessionResponse describes a login session. Current marks the session of
+// the token used for the request.
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+func newPublicUser(user models.User) PublicUser {
+	return PublicUser{
+		ID:        user.ID,
+		Username:  user.Username,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+func newSelfUser(user models.User) SelfUser {
+	return SelfUser{
+		PublicUser: newPublicUser(user),
+		Email:      user.Email,
+		Role:       user.Role,
+		UpdatedAt:  user.UpdatedAt,
+	}
+}
+
+func newAdminUser(user models.User) AdminUser {
+	return AdminUser{
+		SelfUser:     newSelfUser(user),
+		Status:       user.Status,
+		TokenVersion: user.TokenVersion,
+	}
+}
+
+func newBlogResponse(blog models.Blog) BlogResponse {
+	return BlogResponse{
+		ID:          blog.ID,
+		Title:       blog.Title,
+		Description: blog.Description,
+		Completed:   blog.Completed,
+		UserID:      blog.UserID,
+		CreatedAt:   blog.CreatedAt,
+		UpdatedAt:   blog.UpdatedAt,
+	}
+}
+
+func newBlogResponses(blogs []models.Blog) []BlogResponse {
+	responses := make([]BlogResponse, 0, len(blogs))
+	for _, blog := range blogs {
+		responses = append(responses, newBlogResponse(blog))
+	}
+	return responses
+}
+
+func newPasskeyResponse(cred models.WebAuthnCredential) PasskeyResponse {
+	return PasskeyResponse{
+		ID:         cred.ID,
+		Name:       cred.Name,
+		CreatedAt:  cred.CreatedAt,
+		LastUsedAt: cred.LastUsedAt,
+	}
+}
+
+func newPersonalAccessTokenResponse(pat models.PersonalAccessToken) PersonalAccessTokenResponse {
+	return PersonalAccessTokenResponse{
+		ID:         pat.ID,
+		Name:       pat.Name,
+		Prefix:     pat.Prefix,
+		Scopes:     models.SplitScopes(pat.Scopes),
+		CreatedAt:  pat.CreatedAt,
+		ExpiresAt:  pat.ExpiresAt,
+		LastUsedAt: pat.LastUsedAt,
+	}
+}
+
+func newInviteResponse(invite models.Invite) InviteResponse {
+	return InviteResponse{
+		ID:        invite.ID,
+		Prefix:    invite.Prefix,
+		MaxUses:   invite.MaxUses,
+		Uses:      invite.Uses,
+		CreatedAt: invite.CreatedAt,
+		ExpiresAt: invite.ExpiresAt,
+	}
+}
+
+func newSessionResponse(session models.Session, currentID string) SessionResponse {
+	return SessionResponse{
+		ID:         session.ID,
+		Device:     session.Device,
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		Current:    session.ID == currentID,
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserViewsOmitPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("StrongPassw0rd!"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	user := models.User{
+		Username: "ViewTestUser",
+		Email:    "viewtestuser@example.com",
+		Password: string(hash),
+		Role:     models.RoleAuthor,
+		Blogs:    []models.Blog{{Title: "Preloaded"}},
+	}
+
+	views := map[string]interface{}{
+		"model":  user,
+		"public": newPublicUser(user),
+		"self":   newSelfUser(user),
+		"admin":  newAdminUser(user),
+	}
+
+	for name, view := range views {
+		t.Run(name, func(t *testing.T) {
+			body, err := json.Marshal(view)
+			if err != nil {
+				t.Fatalf("Error marshalling view: %v", err)
+			}
+			if bytes.Contains(body, hash) || bytes.Contains(bytes.ToLower(body), []byte("password")) {
+				t.Errorf("response leaks the password hash: %s", body)
+			}
+			if bytes.Contains(body, []byte("Preloaded")) {
+				t.Errorf("response leaks preloaded blogs: %s", body)
+			}
+		})
+	}
+
+	if body, _ := json.Marshal(newPublicUser(user)); bytes.Contains(body, []byte(user.Email)) {
+		t.Errorf("public profile leaks the email address: %s", body)
+	}
+}
+
+func TestGetUserViews(t *testing.T) {
+	setupTestDB(t)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("StrongPassw0rd!"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	user := createTestUser(t, models.User{Username: "GetUserViews", Email: "getuserviews@example.com", Password: string(hash)})
+
+	tests := []struct {
+		name        string
+		callerID    uint
+		callerRole  models.Role
+		expectEmail bool
+	}{
+		{name: "Other user sees the public profile", callerID: user.ID + 1, callerRole: models.RoleAuthor, expectEmail: false},
+		{name: "Owner sees their own account", callerID: user.ID, callerRole: models.RoleAuthor, expectEmail: true},
+		{name: "Admin sees the admin view", callerID: user.ID + 1, callerRole: models.RoleAdmin, expectEmail: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			id := strconv.Itoa(int(user.ID))
+			req := httptest.NewRequest("GET", "/api/user/"+id, nil)
+			req = mux.SetURLVars(req, map[string]string{"id": id})
+			ctx := context.WithValue(req.Context(), middlewares.UserIDKey, tc.callerID)
+			ctx = context.WithValue(ctx, middlewares.RoleKey, tc.callerRole)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			GetUser(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+			}
+			if bytes.Contains(rr.Body.Bytes(), hash) || bytes.Contains(rr.Body.Bytes(), []byte("password")) {
+				t.Errorf("response leaks the password hash: %s", rr.Body.String())
+			}
+			if hasEmail := bytes.Contains(rr.Body.Bytes(), []byte(user.Email)); hasEmail != tc.expectEmail {
+				t.Errorf("unexpected email visibility: got %v want %v", hasEmail, tc.expectEmail)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+func TestRevocation(t *testing.T) {
+	setupTestDB(t)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("Password!23"), bcrypt.MinCost)
+	now := time.Now()
+	user := createTestUser(t, models.User{Username: "RevokeUser", Email: "revoke@example.com", Password: string(hash), EmailVerifiedAt: &now})
+
+	login := func() tokenResponse {
+		body, _ := json.Marshal(map[string]string{"username": user.Username, "password": "Password!23"})
+		rr := httptest.NewRecorder()
+		Login(rr, httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Login failed with %v: %s", rr.Code, rr.Body.String())
+		}
+		var tokens tokenResponse
+		json.Unmarshal(rr.Body.Bytes(), &tokens)
+		return tokens
+	}
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(middlewares.AuthMiddleware)
+	api.HandleFunc("/user/blogs", GetUserBlogs).Methods("GET")
+	api.HandleFunc("/logout", Logout).Methods("POST")
+	api.HandleFunc("/logout/all", LogoutAll).Methods("POST")
+	router.HandleFunc("/api/token/refresh", RefreshToken).Methods("POST")
+
+	call := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Refuses a revoked access token", func(t *testing.T) {
+		tokens := login()
+		if rr := call("GET", "/api/user/blogs", tokens.Token, nil); rr.Code != http.StatusOK {
+			t.Fatalf("Expected the fresh token to be accepted, got %v", rr.Code)
+		}
+		if rr := call("POST", "/api/logout", tokens.Token, nil); rr.Code != http.StatusOK {
+			t.Fatalf("Expected logout to succeed, got %v: %s", rr.Code, rr.Body.String())
+		}
+		if rr := call("GET", "/api/user/blogs", tokens.Token, nil); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the revoked token to be refused, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Logging out everywhere invalidates other tokens", func(t *testing.T) {
+		laptop, phone := login(), login()
+		if rr := call("POST", "/api/logout/all", laptop.Token, nil); rr.Code != http.StatusOK {
+			t.Fatalf("Expected logout to succeed, got %v: %s", rr.Code, rr.Body.String())
+		}
+		if rr := call("GET", "/api/user/blogs", phone.Token, nil); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the other device's access token to be refused, got %v", rr.Code)
+		}
+		if rr := call("POST", "/api/token/refresh", "", map[string]string{"refresh_token": phone.RefreshToken}); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the other device's refresh token to be refused, got %v", rr.Code)
+		}
+		if rr := call("GET", "/api/user/blogs", login().Token, nil); rr.Code != http.StatusOK {
+			t.Errorf("Expected logging in again to work, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Pruning drops expired revocations and cached answers", func(t *testing.T) {
+		previousTTL := config.Auth.RevocationCacheTTL
+		defer func() { config.Auth.RevocationCacheTTL = previousTTL }()
+		config.Auth.RevocationCacheTTL = time.Second
+		t.Cleanup(func() { config.DB.Where("jti LIKE ?", "prune-%").Delete(&models.RevokedToken{}) })
+
+		store := utils.NewRevocationStore()
+		now := time.Now()
+		if err := store.Revoke("prune-expired", user.ID, now.Add(-time.Minute)); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+		if err := store.Revoke("prune-live", user.ID, now.Add(time.Hour)); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+		if revoked, err := store.IsRevoked("prune-checked"); err != nil || revoked {
+			t.Fatalf("Expected an unknown token not to be revoked, got %v, %v", revoked, err)
+		}
+		// Another instance revokes the token after this one cached the answer
+		config.DB.Create(&models.RevokedToken{JTI: "prune-checked", UserID: user.ID, ExpiresAt: now.Add(time.Hour)})
+		if revoked, _ := store.IsRevoked("prune-checked"); revoked {
+			t.Fatal("Expected the cached answer to be used before pruning")
+		}
+
+		if err := store.Prune(now.Add(2 * time.Second)); err != nil {
+			t.Fatalf("Prune: %v", err)
+		}
+		var remaining []string
+		config.DB.Model(&models.RevokedToken{}).Where("jti LIKE ?", "prune-%").Order("jti").Pluck("jti", &remaining)
+		if len(remaining) != 2 || remaining[0] != "prune-checked" || remaining[1] != "prune-live" {
+			t.Errorf("Expected only the expired revocation to be deleted, got %v", remaining)
+		}
+		if revoked, _ := store.IsRevoked("prune-live"); !revoked {
+			t.Error("Expected a live revocation to survive pruning")
+		}
+		if revoked, _ := store.IsRevoked("prune-checked"); !revoked {
+			t.Error("Expected pruning to forget the cached answer")
+		}
+	})
+
+	t.Run("Token versions are forgotten only once the transaction commits", func(t *testing.T) {
+		store := utils.NewRevocationStore()
+		before, err := store.TokenVersion(user.ID)
+		if err != nil {
+			t.Fatalf("TokenVersion: %v", err)
+		}
+
+		rollback := errors.New("rolled back")
+		err = utils.Transaction(config.DB, func(tx *gorm.DB) error {
+			if err := store.BumpTokenVersion(tx, user.ID); err != nil {
+				return err
+			}
+			return rollback
+		})
+		if !errors.Is(err, rollback) {
+			t.Fatalf("Expected the transaction to roll back, got %v", err)
+		}
+		if version, _ := store.TokenVersion(user.ID); version != before {
+			t.Errorf("Expected version %d after a rollback, got %d", before, version)
+		}
+
+		err = utils.Transaction(config.DB, func(tx *gorm.DB) error {
+			if err := store.BumpTokenVersion(tx, user.ID); err != nil {
+				return err
+			}
+			// A concurrent request still sees, and caches, the committed version
+			if version, err := store.TokenVersion(user.ID); err != nil || version != before {
+				t.Errorf("Expected version %d before the commit, got %d, %v", before, version, err)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Transaction: %v", err)
+		}
+		if version, _ := store.TokenVersion(user.ID); version != before+1 {
+			t.Errorf("Expected version %d once committed, got %d", before+1, version)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	middleware "Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// GetSessions lists the devices the current user is logged in on
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+	currentID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+
+	// A session whose refresh token has expired is over even if nobody revoked it
+	var sessions []models.Session
+	err := config.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND last_seen_at > ?", userID, time.Now().Add(-config.Auth.RefreshTokenTTL)).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		http.Error(w, "Failed to retrieve sessions", http.StatusInternalServerError)
+		return
+	}
+
+	responses := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		responses = append(responses, newSessionResponse(session, currentID))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(responses)
+}
+
+// RevokeSession signs the current user out of one session
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+	sessionID := mux.Vars(r)["id"]
+
+	revoked, err := utils.Sessions.Revoke(config.DB, userID, sessionID)
+	if err != nil {
+		log.Printf("Error revoking session: %v", err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if revoked == 0 {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session successfully revoked"})
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSessions(t *testing.T) {
+	setupTestDB(t)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("Password!23"), bcrypt.MinCost)
+	now := time.Now()
+	user := createTestUser(t, models.User{Username: "SessionsUser", Email: "sessions@example.com", Password: string(hash), EmailVerifiedAt: &now})
+
+	login := func(userAgent string) tokenResponse {
+		body, _ := json.Marshal(map[string]string{"username": user.Username, "password": "Password!23"})
+		req := httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body))
+		req.Header.Set("User-Agent", userAgent)
+		rr := httptest.NewRecorder()
+		Login(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Login failed with %v: %s", rr.Code, rr.Body.String())
+		}
+		var tokens tokenResponse
+		json.Unmarshal(rr.Body.Bytes(), &tokens)
+		return tokens
+	}
+	laptop := login("Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0")
+	phone := login("curl/8.5.0")
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(middlewares.AuthMiddleware)
+	api.HandleFunc("/user/sessions", GetSessions).Methods("GET")
+	api.HandleFunc("/user/sessions/{id}", RevokeSession).Methods("DELETE")
+
+	call := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := call("GET", "/api/user/sessions", laptop.Token)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v", http.StatusOK, rr.Code)
+	}
+	var sessions []SessionResponse
+	json.Unmarshal(rr.Body.Bytes(), &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %+v", sessions)
+	}
+
+	var phoneSession SessionResponse
+	for _, s := range sessions {
+		if s.Device == "curl" {
+			phoneSession = s
+		} else if !s.Current || s.Device != "Firefox on Windows" {
+			t.Errorf("Unexpected laptop session %+v", s)
+		}
+	}
+	if phoneSession.ID == "" || phoneSession.Current {
+		t.Fatalf("Unexpected phone session %+v", phoneSession)
+	}
+
+	if rr := call("DELETE", "/api/user/sessions/"+phoneSession.ID, laptop.Token); rr.Code != http.StatusOK {
+		t.Fatalf("Expected revoke to succeed, got %v", rr.Code)
+	}
+
+	if rr := call("GET", "/api/user/sessions", phone.Token); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected access token of revoked session to be rejected, got %v", rr.Code)
+	}
+	body, _ := json.Marshal(map[string]string{"refresh_token": phone.RefreshToken})
+	refresh := httptest.NewRecorder()
+	RefreshToken(refresh, httptest.NewRequest("POST", "/api/token/refresh", bytes.NewBuffer(body)))
+	if refresh.Code != http.StatusUnauthorized {
+		t.Errorf("Expected refresh token of revoked session to be rejected, got %v", refresh.Code)
+	}
+
+	if rr := call("GET", "/api/user/sessions", laptop.Token); rr.Code != http.StatusOK {
+		t.Errorf("Expected other session to keep working, got %v", rr.Code)
+	}
+}
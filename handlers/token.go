@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	middleware "Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errRefreshTokenInvalid = errors.New("invalid refresh token")
+
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// issueTokens signs an access token for the session and stores the next
+// refresh token of its family
+func issueTokens(tx *gorm.DB, user models.User, sessionID string) (*tokenResponse, error) {
+	accessToken, err := utils.GenerateSessionJWT(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	record := models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(refreshToken),
+		FamilyID:  sessionID,
+		ExpiresAt: time.Now().Add(config.Auth.RefreshTokenTTL),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(config.Auth.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// respondWithTokens starts a new session for the user and writes the token pair
+func respondWithTokens(w http.ResponseWriter, r *http.Request, user models.User) {
+	// Every way of logging in ends here, so pending accounts are turned away once
+	if user.Status == models.StatusPending {
+		http.Error(w, "Account is awaiting approval by an administrator", http.StatusForbidden)
+		return
+	}
+
+	var tokens *tokenResponse
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		sessionID, err := utils.Sessions.Start(tx, user.ID, r.UserAgent(), utils.ClientIP(r))
+		if err != nil {
+			return err
+		}
+		tokens, err = issueTokens(tx, user, sessionID)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error issuing tokens: %v", err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	if utils.WantsSessionCookies(r) {
+		// Never keep a CSRF cookie from before the login, which another site
+		// may have planted
+		writeSessionCookies(w, tokens, "")
+		return
+	}
+	writeTokens(w, tokens)
+}
+
+// cookieSessionResponse replaces tokenResponse when the tokens go in cookies
+type cookieSessionResponse struct {
+	CSRFToken string `json:"csrf_token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// writeTokens sends the token pair in the response body
+func writeTokens(w http.ResponseWriter, tokens *tokenResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// writeSessionCookies sends the token pair as cookies that scripts cannot
+// read, along with csrfToken, or a new CSRF token if it is empty
+func writeSessionCookies(w http.ResponseWriter, tokens *tokenResponse, csrfToken string) {
+	if csrfToken == "" {
+		var err error
+		if csrfToken, err = utils.GenerateOpaqueToken(); err != nil {
+			log.Printf("Error generating CSRF token: %v", err)
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+	}
+	utils.SetSessionCookies(w, tokens.Token, tokens.RefreshToken, csrfToken)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cookieSessionResponse{CSRFToken: csrfToken, ExpiresIn: tokens.ExpiresIn})
+}
+
+// RefreshToken exchanges a refresh token for a new access/refresh token pair.
+// Presenting a token that was already rotated revokes its whole family.
+// Browsers using cookie sessions send the refresh cookie and their CSRF token
+// instead, and get the new pair as cookies.
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+	fromCookie := false
+	if input.RefreshToken == "" {
+		if cookie, ok := utils.RefreshCookie(r); ok {
+			if !utils.ValidCSRFToken(r) {
+				http.Error(w, "Missing or invalid CSRF token", http.StatusForbidden)
+				return
+			}
+			input.RefreshToken = cookie
+			fromCookie = true
+		}
+	}
+	if input.RefreshToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var response *tokenResponse
+	reused := false
+	err := utils.Transaction(config.DB, func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(input.RefreshToken)).
+			First(&current).Error
+		if err != nil {
+			return errRefreshTokenInvalid
+		}
+
+		now := time.Now()
+		if current.UsedAt != nil || current.RevokedAt != nil {
+			// Replay of a rotated token: assume it leaked and kill every descendant
+			reused = true
+			_, err := utils.Sessions.Revoke(tx, current.UserID, current.FamilyID)
+			return err
+		}
+		if now.After(current.ExpiresAt) {
+			return errRefreshTokenInvalid
+		}
+
+		if err := tx.Model(&current).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.First(&user, current.UserID).Error; err != nil {
+			return errRefreshTokenInvalid
+		}
+
+		err = utils.Sessions.Resume(tx, current.FamilyID, user.ID, r.UserAgent(), utils.ClientIP(r))
+		if errors.Is(err, utils.ErrSessionRevoked) {
+			return errRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		response, err = issueTokens(tx, user, current.FamilyID)
+		return err
+	})
+
+	if fromCookie && (reused || errors.Is(err, errRefreshTokenInvalid)) {
+		// The browser's session is over either way
+		utils.ClearSessionCookies(w)
+	}
+	switch {
+	case reused:
+		log.Printf("Refresh token reuse detected, token family revoked")
+		http.Error(w, "Refresh token has already been used", http.StatusUnauthorized)
+		return
+	case errors.Is(err, errRefreshTokenInvalid):
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	case err != nil:
+		log.Printf("Error rotating refresh token: %v", err)
+		http.Error(w, "Error refreshing token", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case fromCookie:
+		// The CSRF token was just checked against the header, so it is kept
+		csrfToken, _ := utils.CSRFCookie(r)
+		writeSessionCookies(w, response, csrfToken)
+	case utils.WantsSessionCookies(r):
+		writeSessionCookies(w, response, "")
+	default:
+		writeTokens(w, response)
+	}
+}
+
+// revokeAllSessions bumps the user's token version and revokes every session
+// and refresh token, signing the user out of all devices. Personal access
+// tokens keep working; see revokeAllCredentials.
+func revokeAllSessions(tx *gorm.DB, userID uint) error {
+	if err := utils.Revocations.BumpTokenVersion(tx, userID); err != nil {
+		return err
+	}
+	_, err := utils.Sessions.Revoke(tx, userID)
+	return err
+}
+
+// revokeAllCredentials also deletes the user's personal access tokens, for
+// when the password changes because it may have leaked. It returns how many
+// tokens were deleted.
+func revokeAllCredentials(tx *gorm.DB, userID uint) (int64, error) {
+	if err := revokeAllSessions(tx, userID); err != nil {
+		return 0, err
+	}
+	result := tx.Where("user_id = ?", userID).Delete(&models.PersonalAccessToken{})
+	return result.RowsAffected, result.Error
+}
+
+// Logout revokes the access token used for the request and ends its session.
+// Tokens issued before sessions were recorded name their refresh token instead.
+func Logout(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+	jti, ok := r.Context().Value(middleware.TokenIDKey).(string)
+	if !ok {
+		// Requests authenticated by a reverse proxy carry no token to revoke
+		http.Error(w, "Sign out at the proxy that authenticated you", http.StatusBadRequest)
+		return
+	}
+	expiresAt := r.Context().Value(middleware.TokenExpiresAtKey).(time.Time)
+	sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := utils.Revocations.Revoke(jti, userID, expiresAt); err != nil {
+		log.Printf("Error revoking token: %v", err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	if sessionID == "" && input.RefreshToken != "" {
+		var current models.RefreshToken
+		err := config.DB.Where("token_hash = ? AND user_id = ?", utils.HashToken(input.RefreshToken), userID).
+			First(&current).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			log.Printf("Error revoking refresh token: %v", err)
+			http.Error(w, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+		sessionID = current.FamilyID
+	}
+
+	if sessionID != "" {
+		if _, err := utils.Sessions.Revoke(config.DB, userID, sessionID); err != nil {
+			log.Printf("Error revoking session: %v", err)
+			http.Error(w, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if config.Auth.SessionCookies {
+		utils.ClearSessionCookies(w)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Successfully logged out"})
+}
+
+// LogoutAll signs the user out of every device
+func LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	err := utils.Transaction(config.DB, func(tx *gorm.DB) error {
+		return revokeAllSessions(tx, userID)
+	})
+	if err != nil {
+		log.Printf("Error revoking sessions: %v", err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	if config.Auth.SessionCookies {
+		utils.ClearSessionCookies(w)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Successfully logged out of all sessions"})
+}
+
+// consumeActionToken verifies a single-use action token and marks it used, so it
+// cannot be replayed while it is still valid
+func consumeActionToken(token, purpose string) (*utils.ActionClaims, error) {
+	claims, err := utils.ParseActionToken(token, purpose)
+	if err != nil {
+		return nil, err
+	}
+	fresh, err := utils.Revocations.Consume(claims.Id, claims.UserIDValue(), time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, errors.New("action token already used")
+	}
+	return claims, nil
+}
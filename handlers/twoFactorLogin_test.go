@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoginTwoFactor(t *testing.T) {
+	setupTestDB(t)
+
+	hash, _ := utils.HashPassword("Password!23")
+	secret, _ := utils.GenerateTOTPSecret()
+	now := time.Now()
+	user := createTestUser(t, models.User{Username: "TwoFactorUser", Email: "twofactor@example.com", Password: hash,
+		EmailVerifiedAt: &now, TOTPEnabled: true, TOTPSecret: secret})
+
+	codes, _ := utils.GenerateRecoveryCodes(3)
+	for _, code := range codes {
+		config.DB.Create(&models.RecoveryCode{UserID: user.ID, CodeHash: utils.HashToken(code)})
+	}
+
+	challenge := func() string {
+		body, _ := json.Marshal(map[string]string{"identifier": user.Username, "password": "Password!23"})
+		rr := httptest.NewRecorder()
+		Login(rr, httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body)))
+		var response struct {
+			TwoFactorRequired bool   `json:"two_factor_required"`
+			ChallengeToken    string `json:"challenge_token"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if rr.Code != http.StatusOK || !response.TwoFactorRequired || response.ChallengeToken == "" {
+			t.Fatalf("Expected a two-factor challenge, got %v: %s", rr.Code, rr.Body.String())
+		}
+		return response.ChallengeToken
+	}
+	redeem := func(token, recoveryCode string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"challenge_token": token, "recovery_code": recoveryCode})
+		rr := httptest.NewRecorder()
+		LoginTwoFactor(rr, httptest.NewRequest("POST", "/api/login/2fa", bytes.NewBuffer(body)))
+		return rr
+	}
+
+	t.Run("Completes one login per challenge", func(t *testing.T) {
+		token := challenge()
+		if rr := redeem(token, "wrong-code"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected a wrong code to be rejected, got %v", rr.Code)
+		}
+		if rr := redeem(token, codes[0]); rr.Code != http.StatusOK {
+			t.Fatalf("Expected a retry with the right code to succeed, got %v: %s", rr.Code, rr.Body.String())
+		}
+		if rr := redeem(token, codes[1]); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a used challenge to be rejected, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Signing out everywhere voids pending challenges", func(t *testing.T) {
+		token := challenge()
+		if err := utils.Revocations.BumpTokenVersion(config.DB, user.ID); err != nil {
+			t.Fatalf("BumpTokenVersion: %v", err)
+		}
+		if rr := redeem(token, codes[1]); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a challenge from before signing out to be rejected, got %v", rr.Code)
+		}
+		if rr := redeem(challenge(), codes[1]); rr.Code != http.StatusOK {
+			t.Errorf("Expected a new challenge to work with the unused code, got %v: %s", rr.Code, rr.Body.String())
+		}
+	})
+}
+
+func TestDisableTOTPLockout(t *testing.T) {
+	setupTestDB(t)
+
+	previous := config.Auth
+	config.Auth.LoginMaxAccountFailures = 2
+	config.Auth.LoginMaxIPFailures = 100
+	defer func() { config.Auth = previous }()
+
+	hash, _ := utils.HashPassword("Password!23")
+	secret, _ := utils.GenerateTOTPSecret()
+	user := createTestUser(t, models.User{Username: "DisableTwoFactorUser", Email: "disable2fa@example.com", Password: hash,
+		TOTPEnabled: true, TOTPSecret: secret})
+	codes, _ := utils.GenerateRecoveryCodes(1)
+	config.DB.Create(&models.RecoveryCode{UserID: user.ID, CodeHash: utils.HashToken(codes[0])})
+	defer utils.ResetLoginFailures(utils.AccountThrottleKey(user.ID), utils.IPThrottleKey("192.0.2.45"))
+
+	disable := func(password, recoveryCode string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"password": password, "recovery_code": recoveryCode})
+		req := httptest.NewRequest("POST", "/api/user/2fa/disable", bytes.NewBuffer(body))
+		req.RemoteAddr = "192.0.2.45:40000"
+		req = req.WithContext(context.WithValue(req.Context(), middlewares.UserIDKey, user.ID))
+		rr := httptest.NewRecorder()
+		DisableTOTP(rr, req)
+		return rr
+	}
+
+	if rr := disable("WrongPassword!23", codes[0]); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected a wrong password to be rejected, got %v", rr.Code)
+	}
+	if rr := disable("Password!23", "wrong-code"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected a wrong code to be rejected, got %v", rr.Code)
+	}
+
+	// Both failures count, so even the right answers are refused now
+	rr := disable("Password!23", codes[0])
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected status %v with Retry-After, got %v", http.StatusTooManyRequests, rr.Code)
+	}
+	var reloaded models.User
+	config.DB.First(&reloaded, user.ID)
+	if !reloaded.TOTPEnabled {
+		t.Error("Expected two-factor authentication to stay enabled")
+	}
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	middleware "Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+// completeLogin finishes a login once the first factor has been checked. Users
+// with two-factor authentication get a challenge token instead of access tokens.
+func completeLogin(w http.ResponseWriter, r *http.Request, user models.User) {
+	if !user.TOTPEnabled {
+		respondWithTokens(w, r, user)
+		return
+	}
+
+	challenge, err := utils.GenerateActionToken(utils.PurposeTwoFactorChallenge, user, config.Auth.TwoFactorChallengeTTL)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"two_factor_required": true,
+		"challenge_token":     challenge,
+		"expires_in":          int64(config.Auth.TwoFactorChallengeTTL.Seconds()),
+	})
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code.
+// Both are consumed atomically, so the same code never works twice.
+func verifySecondFactor(user models.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := utils.VerifyTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			return false, nil
+		}
+		result := config.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		return result.RowsAffected == 1, result.Error
+	}
+
+	if recoveryCode != "" {
+		hash := utils.HashToken(utils.NormalizeRecoveryCode(recoveryCode))
+		result := config.DB.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hash).
+			Update("used_at", time.Now())
+		return result.RowsAffected == 1, result.Error
+	}
+
+	return false, nil
+}
+
+// LoginTwoFactor completes a login started by Login for a user with 2FA enabled
+func LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ChallengeToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := utils.ParseActionToken(input.ChallengeToken, utils.PurposeTwoFactorChallenge)
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+
+	// Signing out everywhere or changing the password also voids pending challenges
+	var user models.User
+	if err := config.DB.First(&user, claims.UserIDValue()).Error; err != nil || !user.TOTPEnabled || claims.TokenVersion != user.TokenVersion {
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+
+	// A six-digit code is guessable without a limit, so it shares the account's allowance
+	accountKey := utils.AccountThrottleKey(user.ID)
+	if loginThrottled(w, accountKey, utils.IPThrottleKey(utils.ClientIP(r))) {
+		return
+	}
+
+	ok, err := verifySecondFactor(user, input.Code, input.RecoveryCode)
+	if err != nil {
+		log.Printf("Error verifying second factor: %v", err)
+		http.Error(w, "Error verifying code", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		recordLoginFailure(r, user.ID)
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	// A wrong code may be retried with the same challenge, but it completes only one login
+	if _, err := consumeActionToken(input.ChallengeToken, utils.PurposeTwoFactorChallenge); err != nil {
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := utils.ResetLoginFailures(accountKey); err != nil {
+		log.Printf("Error resetting login failures: %v", err)
+	}
+	respondWithTokens(w, r, user)
+}
+
+// EnrollTOTP generates a new TOTP secret for the user. It is not enforced until
+// confirmed with ConfirmTOTP.
+func EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		http.Error(w, "Error generating secret", http.StatusInternalServerError)
+		return
+	}
+	if err := config.DB.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(secret, user.Username, config.Auth.TOTPIssuer),
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves their
+// authenticator works, and returns the recovery codes. They are shown only once.
+func ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.TOTPSecret == "" {
+		http.Error(w, "Two-factor enrollment has not been started", http.StatusBadRequest)
+		return
+	}
+
+	step, ok := utils.VerifyTOTP(user.TOTPSecret, input.Code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, code := range codes {
+			if err := tx.Create(&models.RecoveryCode{UserID: user.ID, CodeHash: utils.HashToken(code)}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error
+	})
+	if err != nil {
+		log.Printf("Error enabling two-factor authentication: %v", err)
+		http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP turns two-factor authentication off. It needs the password and a
+// current code or recovery code, so a stolen access token alone is not enough.
+func DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	var input struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if !user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	// Like ChangePassword, guessing the password or the code counts against the
+	// account's login limit
+	if loginThrottled(w, utils.AccountThrottleKey(user.ID)) {
+		return
+	}
+	if _, err := authenticate(user, input.Password); err != nil {
+		recordLoginFailure(r, user.ID)
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	ok, err := verifySecondFactor(user, input.Code, input.RecoveryCode)
+	if err != nil {
+		log.Printf("Error verifying second factor: %v", err)
+		http.Error(w, "Error verifying code", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		recordLoginFailure(r, user.ID)
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error
+	})
+	if err != nil {
+		log.Printf("Error disabling two-factor authentication: %v", err)
+		http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
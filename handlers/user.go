@@ -2,29 +2,56 @@ package handlers
 
 import (
 	"Blogsite/config"
+	middleware "Blogsite/middlewares"
 	"Blogsite/models"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
-// GetUser handler
+// GetUser handler. Callers see the public profile, their own account in full,
+// and admins additionally see moderation fields.
 func GetUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	var user models.User
-	if err := config.DB.Preload("Blogs").First(&user, id).Error; err != nil {
+	if err := config.DB.First(&user, id).Error; err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
+
+	var response interface{}
+	switch {
+	case middleware.Allowed(r.Context(), models.PermUsersManage):
+		response = newAdminUser(user)
+	case r.Context().Value(middleware.UserIDKey).(uint) == user.ID:
+		response = newSelfUser(user)
+	default:
+		response = newPublicUser(user)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(response)
 }
 
+// UpdateUser handler (account owner or admin)
 func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id := vars["id"]
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if !authorize(r, uint(id), models.PermUsersUpdateOwn, models.PermUsersUpdateAny) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 
 	var user models.User
 	if err := config.DB.First(&user, id).Error; err != nil {
@@ -32,9 +59,10 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Omitted fields are left unchanged
 	var input struct {
-		Username string `json:"username"`
-		Email    string `json:"email"`
+		Username *string `json:"username"`
+		Email    *string `json:"email"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
@@ -42,15 +70,60 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update the user information
-	user.Username = input.Username
-	user.Email = input.Email
+	if input.Username != nil && *input.Username != user.Username && !hasLocalPassword(user) {
+		http.Error(w, "Your username is managed by your directory and cannot be changed here", http.StatusConflict)
+		return
+	}
+	if input.Username != nil {
+		if err := validateUsername(*input.Username); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user.Username = *input.Username
+	}
+
+	emailChanged := false
+	if input.Email != nil {
+		email := normalizeEmail(*input.Email)
+		if !isValidEmail(email) {
+			http.Error(w, "Invalid email format", http.StatusBadRequest)
+			return
+		}
+		if email != user.Email {
+			// A new address has to be confirmed again
+			user.Email = email
+			user.EmailVerifiedAt = nil
+			emailChanged = true
+		}
+	}
+
+	// Check up front for a friendly message; the unique indexes still catch races below
+	taken, err := usernameOrEmailTaken(user.Username, user.Email, user.ID)
+	if err != nil {
+		log.Printf("Error checking for duplicate users: %v", err)
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		http.Error(w, "Username or email already in use", http.StatusConflict)
+		return
+	}
 
 	if err := config.DB.Save(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			http.Error(w, "Username or email already in use", http.StatusConflict)
+			return
+		}
 		http.Error(w, "Failed to update user", http.StatusInternalServerError)
 		return
 	}
 
+	if emailChanged {
+		if err := sendVerificationEmail(user); err != nil {
+			log.Printf("Error sending verification email: %v", err)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	response := map[string]string{"message": "User successfully updated"}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"Blogsite/middlewares"
+	"Blogsite/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestUpdateUser(t *testing.T) {
+	setupTestDB(t)
+
+	purgeTestUsers(t, "updatedowner@example.com")
+	owner := createTestUser(t, models.User{Username: "UpdateOwner", Email: "updateowner@example.com", Password: "HashedPassword!23"})
+	other := createTestUser(t, models.User{Username: "UpdateOther", Email: "updateother@example.com", Password: "HashedPassword!23"})
+
+	tests := []struct {
+		name           string
+		callerID       uint
+		callerRole     models.Role
+		payload        map[string]string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Other user cannot update the profile",
+			callerID:       other.ID,
+			callerRole:     models.RoleAuthor,
+			payload:        map[string]string{"username": "HijackedName"},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Forbidden",
+		},
+		{
+			name:           "Invalid username",
+			callerID:       owner.ID,
+			callerRole:     models.RoleAuthor,
+			payload:        map[string]string{"username": "bad name"},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Username must",
+		},
+		{
+			name:           "Invalid email",
+			callerID:       owner.ID,
+			callerRole:     models.RoleAuthor,
+			payload:        map[string]string{"email": "not-an-email"},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid email format",
+		},
+		{
+			name:           "Duplicate email",
+			callerID:       owner.ID,
+			callerRole:     models.RoleAuthor,
+			payload:        map[string]string{"email": "updateother@example.com"},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   "already in use",
+		},
+		{
+			name:           "Owner updates the profile",
+			callerID:       owner.ID,
+			callerRole:     models.RoleAuthor,
+			payload:        map[string]string{"email": "updatedowner@example.com"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "User successfully updated",
+		},
+		{
+			name:           "Admin updates another profile",
+			callerID:       other.ID,
+			callerRole:     models.RoleAdmin,
+			payload:        map[string]string{"username": "UpdatedByAdmin"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "User successfully updated",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(tc.payload)
+			id := strconv.Itoa(int(owner.ID))
+			req := httptest.NewRequest("PUT", "/api/user/"+id, bytes.NewBuffer(body))
+			req = mux.SetURLVars(req, map[string]string{"id": id})
+
+			ctx := context.WithValue(req.Context(), middlewares.UserIDKey, tc.callerID)
+			ctx = context.WithValue(ctx, middlewares.RoleKey, tc.callerRole)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			UpdateUser(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatus)
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte(tc.expectedBody)) {
+				t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"Blogsite/config"
+	middleware "Blogsite/middlewares"
+	"Blogsite/models"
+	"Blogsite/utils"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const maxPasskeyNameLength = 64
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+func relyingParty() utils.RelyingParty {
+	return utils.RelyingParty{ID: config.Auth.WebAuthnRPID, Origins: config.Auth.WebAuthnOrigins}
+}
+
+func credentialDescriptors(creds []models.WebAuthnCredential) []credentialDescriptor {
+	descriptors := make([]credentialDescriptor, 0, len(creds))
+	for _, cred := range creds {
+		descriptors = append(descriptors, credentialDescriptor{Type: "public-key", ID: cred.CredentialID})
+	}
+	return descriptors
+}
+
+// decoyKey keys the credential IDs made up for usernames without passkeys
+var (
+	decoyKey   []byte
+	decoyKeyMu sync.Mutex
+)
+
+// decoyDescriptors makes up a credential for a username that is unknown or has
+// no passkeys, so that the login options do not tell whether an account exists.
+// The same username gets the same made-up credential for the life of the process.
+func decoyDescriptors(username string) ([]credentialDescriptor, error) {
+	decoyKeyMu.Lock()
+	if decoyKey == nil {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			decoyKeyMu.Unlock()
+			return nil, err
+		}
+		decoyKey = key
+	}
+	mac := hmac.New(sha256.New, decoyKey)
+	decoyKeyMu.Unlock()
+
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(username))))
+	return []credentialDescriptor{{Type: "public-key", ID: base64.RawURLEncoding.EncodeToString(mac.Sum(nil))}}, nil
+}
+
+// newCeremony returns a fresh challenge and the token that carries it back to
+// the finishing handler, so no ceremony state is kept on the server
+func newCeremony(purpose string, userID uint) (string, string, error) {
+	challenge, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	token, err := utils.GenerateChallengeToken(purpose, userID, challenge, config.Auth.WebAuthnTimeout)
+	if err != nil {
+		return "", "", err
+	}
+	return challenge, token, nil
+}
+
+// BeginPasskeyRegistration returns the options for navigator.credentials.create()
+func BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	// A passkey would keep a directory or proxy user logging in after the
+	// directory or gateway has shut them out
+	if !hasLocalPassword(user) {
+		http.Error(w, "Passkeys are not available for this account", http.StatusForbidden)
+		return
+	}
+
+	var existing []models.WebAuthnCredential
+	if err := config.DB.Where("user_id = ?", user.ID).Find(&existing).Error; err != nil {
+		http.Error(w, "Failed to retrieve passkeys", http.StatusInternalServerError)
+		return
+	}
+
+	challenge, token, err := newCeremony(utils.PurposeWebAuthnRegistration, user.ID)
+	if err != nil {
+		http.Error(w, "Error generating challenge", http.StatusInternalServerError)
+		return
+	}
+
+	params := make([]map[string]interface{}, 0, len(utils.SupportedCOSEAlgorithms))
+	for _, alg := range utils.SupportedCOSEAlgorithms {
+		params = append(params, map[string]interface{}{"type": "public-key", "alg": alg})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"challenge_token": token,
+		"publicKey": map[string]interface{}{
+			"challenge": challenge,
+			"rp":        map[string]string{"id": config.Auth.WebAuthnRPID, "name": config.Auth.WebAuthnRPName},
+			"user": map[string]string{
+				"id":          base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(user.ID), 10))),
+				"name":        user.Username,
+				"displayName": user.Username,
+			},
+			"pubKeyCredParams":   params,
+			"timeout":            config.Auth.WebAuthnTimeout.Milliseconds(),
+			"attestation":        "none",
+			"excludeCredentials": credentialDescriptors(existing),
+			"authenticatorSelection": map[string]string{
+				"residentKey":      "preferred",
+				"userVerification": "required",
+			},
+		},
+	})
+}
+
+// FinishPasskeyRegistration verifies the authenticator's response and stores the new passkey
+func FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	var input struct {
+		ChallengeToken string `json:"challenge_token"`
+		Name           string `json:"name"`
+		Credential     struct {
+			ID       string `json:"id"`
+			Response struct {
+				ClientDataJSON    string `json:"clientDataJSON"`
+				AttestationObject string `json:"attestationObject"`
+			} `json:"response"`
+		} `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ChallengeToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > maxPasskeyNameLength {
+		http.Error(w, "Passkey name must be at most 64 characters long", http.StatusBadRequest)
+		return
+	}
+
+	clientDataJSON, err := utils.DecodeBase64URL(input.Credential.Response.ClientDataJSON)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	attestationObject, err := utils.DecodeBase64URL(input.Credential.Response.AttestationObject)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := consumeActionToken(input.ChallengeToken, utils.PurposeWebAuthnRegistration)
+	if err != nil || claims.UserIDValue() != userID {
+		http.Error(w, "Invalid or expired challenge token", http.StatusBadRequest)
+		return
+	}
+
+	cred, err := relyingParty().VerifyRegistration(claims.Challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		log.Printf("Passkey registration rejected: %v", err)
+		http.Error(w, "Passkey registration failed", http.StatusBadRequest)
+		return
+	}
+	credentialID := base64.RawURLEncoding.EncodeToString(cred.ID)
+	if input.Credential.ID != "" && input.Credential.ID != credentialID {
+		http.Error(w, "Passkey registration failed", http.StatusBadRequest)
+		return
+	}
+
+	record := models.WebAuthnCredential{
+		UserID:       userID,
+		Name:         name,
+		CredentialID: credentialID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+		AAGUID:       cred.AAGUID,
+	}
+	if err := config.DB.Create(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			http.Error(w, "Passkey is already registered", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to save passkey", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newPasskeyResponse(record))
+}
+
+// GetPasskeys lists the passkeys registered by the current user
+func GetPasskeys(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	var creds []models.WebAuthnCredential
+	if err := config.DB.Where("user_id = ?", userID).Order("created_at").Find(&creds).Error; err != nil {
+		http.Error(w, "Failed to retrieve passkeys", http.StatusInternalServerError)
+		return
+	}
+
+	responses := make([]PasskeyResponse, 0, len(creds))
+	for _, cred := range creds {
+		responses = append(responses, newPasskeyResponse(cred))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(responses)
+}
+
+// DeletePasskey revokes one of the current user's passkeys
+func DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(uint)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid passkey ID", http.StatusBadRequest)
+		return
+	}
+
+	// Deleted outright so the credential ID can be registered again later
+	result := config.DB.Unscoped().Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		http.Error(w, "Failed to delete passkey", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Passkey not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Passkey successfully deleted"})
+}
+
+// BeginPasskeyLogin returns the options for navigator.credentials.get(). The
+// username is optional; without it the authenticator offers discoverable passkeys.
+func BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Username string `json:"username"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	descriptors := []credentialDescriptor{}
+	if input.Username != "" {
+		allowed := []models.WebAuthnCredential{}
+		if user, err := findUserByIdentifier(input.Username); err == nil {
+			if err := config.DB.Where("user_id = ?", user.ID).Find(&allowed).Error; err != nil {
+				http.Error(w, "Failed to retrieve passkeys", http.StatusInternalServerError)
+				return
+			}
+		}
+		descriptors = credentialDescriptors(allowed)
+		if len(descriptors) == 0 {
+			decoys, err := decoyDescriptors(input.Username)
+			if err != nil {
+				http.Error(w, "Error generating challenge", http.StatusInternalServerError)
+				return
+			}
+			descriptors = decoys
+		}
+	}
+
+	// The challenge is not bound to the user either, since its claims can be
+	// read by the client; the assertion alone decides whose passkey it is
+	challenge, token, err := newCeremony(utils.PurposeWebAuthnAuthentication, 0)
+	if err != nil {
+		http.Error(w, "Error generating challenge", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"challenge_token": token,
+		"publicKey": map[string]interface{}{
+			"challenge":        challenge,
+			"rpId":             config.Auth.WebAuthnRPID,
+			"timeout":          config.Auth.WebAuthnTimeout.Milliseconds(),
+			"userVerification": "required",
+			"allowCredentials": descriptors,
+		},
+	})
+}
+
+// FinishPasskeyLogin verifies an assertion and signs the passkey's owner in.
+// The authenticator has verified the user as well as their presence, so the
+// passkey counts as two factors and TOTP is not asked for. Directory and proxy
+// users log in through the directory or gateway only.
+func FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token"`
+		Credential     struct {
+			ID       string `json:"id"`
+			Response struct {
+				ClientDataJSON    string `json:"clientDataJSON"`
+				AuthenticatorData string `json:"authenticatorData"`
+				Signature         string `json:"signature"`
+			} `json:"response"`
+		} `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ChallengeToken == "" || input.Credential.ID == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	credentialID, err := utils.DecodeBase64URL(input.Credential.ID)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	clientDataJSON, err := utils.DecodeBase64URL(input.Credential.Response.ClientDataJSON)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	authData, err := utils.DecodeBase64URL(input.Credential.Response.AuthenticatorData)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	signature, err := utils.DecodeBase64URL(input.Credential.Response.Signature)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := consumeActionToken(input.ChallengeToken, utils.PurposeWebAuthnAuthentication)
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+
+	var record models.WebAuthnCredential
+	if err := config.DB.Where("credential_id = ?", base64.RawURLEncoding.EncodeToString(credentialID)).First(&record).Error; err != nil {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	signCount, err := relyingParty().VerifyAssertion(claims.Challenge, utils.WebAuthnCredential{
+		ID:        credentialID,
+		PublicKey: record.PublicKey,
+		SignCount: record.SignCount,
+	}, clientDataJSON, authData, signature)
+	if err != nil {
+		log.Printf("Passkey assertion rejected for credential %d: %v", record.ID, err)
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	// The counter only moves forward; losing a race with a concurrent login
+	// using the same counter value means one of them is a clone
+	result := config.DB.Model(&models.WebAuthnCredential{}).
+		Where("id = ? AND sign_count = ?", record.ID, record.SignCount).
+		Updates(map[string]interface{}{"sign_count": signCount, "last_used_at": time.Now()})
+	if result.Error != nil {
+		http.Error(w, "Failed to update passkey", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected != 1 {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, record.UserID).Error; err != nil || !hasLocalPassword(user) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	if config.Auth.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		http.Error(w, "Email address has not been verified", http.StatusForbidden)
+		return
+	}
+
+	respondWithTokens(w, r, user)
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"Blogsite/config"
 	"Blogsite/routes"
+	"Blogsite/utils"
+	"context"
 	"log"
 	"net/http"
 )
@@ -10,6 +12,39 @@ import (
 func main() {
 	config.InitDB()
 
+	if err := utils.InitKeys(); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %s\n", err.Error())
+	}
+
+	// Falling back to open registration on a typo would be worse than not starting
+	if !config.Auth.RegistrationMode.Valid() {
+		log.Fatalf("Invalid REGISTRATION_MODE %q, expected open, invite or approval\n", config.Auth.RegistrationMode)
+	}
+
+	if err := utils.CheckPasswordHashConfig(); err != nil {
+		log.Fatalf("Invalid password hashing settings: %s\n", err.Error())
+	}
+
+	if err := utils.InitPasswordPolicy(); err != nil {
+		log.Fatalf("Failed to load breached password list: %s\n", err.Error())
+	}
+
+	if err := utils.InitMailer(); err != nil {
+		log.Fatalf("Failed to set up mailer: %s\n", err.Error())
+	}
+
+	// Nobody could confirm their address, and so log in, if the links never leave the server
+	if config.Auth.RequireEmailVerification && config.Mail.Driver != "smtp" {
+		log.Printf("ERROR: REQUIRE_EMAIL_VERIFICATION is on but MAIL_DRIVER is %q, so users never receive their verification links\n", config.Mail.Driver)
+	}
+
+	// Periodically drop revocations, failed login counts, sessions, unfinished OIDC logins and deleted accounts that no longer matter
+	utils.Revocations.StartPruning(context.Background(), config.Auth.RevocationPruneInterval)
+	utils.StartLoginThrottlePruning(context.Background(), config.Auth.LoginFailureWindow)
+	utils.Sessions.StartPruning(context.Background(), config.Auth.RevocationPruneInterval)
+	utils.StartOIDCLoginPruning(context.Background(), config.Auth.RevocationPruneInterval)
+	utils.StartAccountPurging(context.Background(), config.Auth.RevocationPruneInterval)
+
 	// Set up the router
 	router := routes.SetupRoutes()
 
@@ -1,50 +1,185 @@
 package middlewares
 
 import (
+	"Blogsite/models"
 	"Blogsite/utils"
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type key int
 
 const (
 	UserIDKey key = iota
+	TokenIDKey
+	TokenExpiresAtKey
+	RoleKey
+	// ScopesKey is only set for personal access tokens; login tokens carry every scope
+	ScopesKey
+	SessionIDKey
 )
 
+// tokenErrorReasons maps token validation errors to the reason sent to the client
+var tokenErrorReasons = []struct {
+	err    error
+	reason string
+}{
+	{utils.ErrTokenExpired, "Token has expired"},
+	{utils.ErrTokenNotYetValid, "Token is not valid yet"},
+	{utils.ErrTokenIssuer, "Invalid token issuer"},
+	{utils.ErrTokenAudience, "Invalid token audience"},
+	{utils.ErrTokenSignature, "Invalid token signature"},
+	{utils.ErrTokenMalformed, "Malformed token"},
+	{utils.ErrTokenClaims, "Invalid token claims"},
+}
+
+func unauthorized(w http.ResponseWriter, reason string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="`+reason+`"`)
+	http.Error(w, reason, http.StatusUnauthorized)
+}
+
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+		if username, email, ok := utils.ProxyAuthHeaders(r); ok {
+			serveWithProxyUser(w, r, next, username, email)
 			return
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			http.Error(w, "Bearer token required", http.StatusUnauthorized)
+		var tokenString string
+		if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+			if tokenString == authHeader {
+				http.Error(w, "Bearer token required", http.StatusUnauthorized)
+				return
+			}
+
+			if utils.IsPersonalAccessToken(tokenString) {
+				serveWithPersonalAccessToken(w, r, next, tokenString)
+				return
+			}
+		} else if cookie, ok := utils.SessionCookie(r); ok {
+			// Browsers attach the cookie to requests other sites make too
+			if !utils.IsSafeMethod(r.Method) && !utils.ValidCSRFToken(r) {
+				http.Error(w, "Missing or invalid CSRF token", http.StatusForbidden)
+				return
+			}
+			tokenString = cookie
+		} else {
+			http.Error(w, "Authorization header is required", http.StatusUnauthorized)
 			return
 		}
 
-		userIDStr, err := utils.ParseJWT(tokenString)
+		claims, err := utils.ParseJWTClaims(tokenString)
 		if err != nil {
 			log.Printf("Error parsing JWT: %v", err)
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			reason := "Invalid token"
+			for _, tokenErr := range tokenErrorReasons {
+				if errors.Is(err, tokenErr.err) {
+					reason = tokenErr.reason
+					break
+				}
+			}
+			unauthorized(w, reason)
 			return
 		}
 
-		userID, err := strconv.ParseUint(userIDStr, 10, 64)
+		userID, err := strconv.ParseUint(claims.UserID, 10, 64)
 		if err != nil {
 			log.Printf("Error converting user ID: %v", err)
-			http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
+			unauthorized(w, "Invalid user ID in token")
 			return
 		}
 
+		revoked, err := utils.Revocations.IsRevoked(claims.Id)
+		if err != nil {
+			log.Printf("Error checking token revocation: %v", err)
+			http.Error(w, "Could not verify token", http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			unauthorized(w, "Token has been revoked")
+			return
+		}
+
+		version, err := utils.Revocations.TokenVersion(uint(userID))
+		if err != nil {
+			log.Printf("Error loading token version: %v", err)
+			unauthorized(w, "Invalid token")
+			return
+		}
+		if claims.TokenVersion != version {
+			unauthorized(w, "Token has been revoked")
+			return
+		}
+
+		if claims.SessionID != "" {
+			active, err := utils.Sessions.Touch(claims.SessionID, time.Now())
+			if err != nil {
+				log.Printf("Error checking session: %v", err)
+				http.Error(w, "Could not verify token", http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				unauthorized(w, "Session has been revoked")
+				return
+			}
+		}
+
 		log.Printf("Extracted user ID: %v (type: %T)", userID, userID)
 		ctx := context.WithValue(r.Context(), UserIDKey, uint(userID))
+		ctx = context.WithValue(ctx, TokenIDKey, claims.Id)
+		ctx = context.WithValue(ctx, TokenExpiresAtKey, time.Unix(claims.ExpiresAt, 0))
+		ctx = context.WithValue(ctx, RoleKey, models.Role(claims.Role))
+		ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+func serveWithPersonalAccessToken(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	pat, user, err := utils.AuthenticatePersonalAccessToken(token, time.Now())
+	if errors.Is(err, utils.ErrPersonalAccessTokenInvalid) {
+		unauthorized(w, "Invalid or expired personal access token")
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking personal access token: %v", err)
+		http.Error(w, "Could not verify token", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, user.ID)
+	ctx = context.WithValue(ctx, RoleKey, user.Role)
+	ctx = context.WithValue(ctx, ScopesKey, models.SplitScopes(pat.Scopes))
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// serveWithProxyUser trusts the user a reverse proxy has already authenticated.
+// The request carries no token, so it is not limited by scopes.
+func serveWithProxyUser(w http.ResponseWriter, r *http.Request, next http.Handler, username, email string) {
+	user, err := utils.ProxyUser(username, email)
+	switch {
+	case errors.Is(err, utils.ErrProxyUserInvalid), errors.Is(err, utils.ErrProxyUserUnknown):
+		http.Error(w, "No account for the user named by the proxy", http.StatusForbidden)
+		return
+	case errors.Is(err, utils.ErrProxyUserConflict):
+		http.Error(w, "An account with this username or email already exists", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error loading proxy user: %v", err)
+		http.Error(w, "Could not verify user", http.StatusInternalServerError)
+		return
+	}
+	if user.Status == models.StatusPending {
+		http.Error(w, "Account is awaiting approval by an administrator", http.StatusForbidden)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, user.ID)
+	ctx = context.WithValue(ctx, RoleKey, user.Role)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
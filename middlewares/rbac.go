@@ -0,0 +1,85 @@
+package middlewares
+
+import (
+	"Blogsite/models"
+	"context"
+	"net/http"
+)
+
+// RoleFromContext returns the role placed in the context by AuthMiddleware
+func RoleFromContext(ctx context.Context) models.Role {
+	role, _ := ctx.Value(RoleKey).(models.Role)
+	return role
+}
+
+// ScopesFromContext returns the scopes of a personal access token. ok is false
+// for login tokens, which are not limited by scopes.
+func ScopesFromContext(ctx context.Context) (scopes []models.Scope, ok bool) {
+	scopes, ok = ctx.Value(ScopesKey).([]models.Scope)
+	return scopes, ok
+}
+
+// Allowed reports whether the caller's role grants perm and, for personal
+// access tokens, whether the token has the matching scope
+func Allowed(ctx context.Context, perm models.Permission) bool {
+	if !RoleFromContext(ctx).Can(perm) {
+		return false
+	}
+	scopes, limited := ScopesFromContext(ctx)
+	if !limited {
+		return true
+	}
+	required, ok := perm.Scope()
+	if !ok {
+		return false
+	}
+	for _, s := range scopes {
+		if s == required {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole only lets requests through whose role is one of roles.
+// It must run after AuthMiddleware.
+func RequireRole(roles ...models.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role := RoleFromContext(r.Context())
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+	}
+}
+
+// RequirePermission only lets requests through that are Allowed perm.
+// It must run after AuthMiddleware.
+func RequirePermission(perm models.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !Allowed(r.Context(), perm) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DenyPersonalAccessTokens keeps account management, such as changing
+// credentials or signing out, to login tokens. It must run after AuthMiddleware.
+func DenyPersonalAccessTokens(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, limited := ScopesFromContext(r.Context()); limited {
+			http.Error(w, "Not available to personal access tokens", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,125 @@
+package middlewares
+
+import (
+	"Blogsite/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequirePermission(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		role           models.Role
+		permission     models.Permission
+		expectedStatus int
+	}{
+		{name: "Reader can read blogs", role: models.RoleReader, permission: models.PermBlogsRead, expectedStatus: http.StatusOK},
+		{name: "Reader cannot create blogs", role: models.RoleReader, permission: models.PermBlogsCreate, expectedStatus: http.StatusForbidden},
+		{name: "Author can create blogs", role: models.RoleAuthor, permission: models.PermBlogsCreate, expectedStatus: http.StatusOK},
+		{name: "Author cannot edit other blogs", role: models.RoleAuthor, permission: models.PermBlogsUpdateAny, expectedStatus: http.StatusForbidden},
+		{name: "Editor can edit other blogs", role: models.RoleEditor, permission: models.PermBlogsUpdateAny, expectedStatus: http.StatusOK},
+		{name: "Editor cannot manage users", role: models.RoleEditor, permission: models.PermUsersManage, expectedStatus: http.StatusForbidden},
+		{name: "Admin can manage users", role: models.RoleAdmin, permission: models.PermUsersManage, expectedStatus: http.StatusOK},
+		{name: "Missing role", role: "", permission: models.PermBlogsRead, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/feed", nil)
+			req = req.WithContext(context.WithValue(req.Context(), RoleKey, tc.role))
+			rr := httptest.NewRecorder()
+
+			RequirePermission(tc.permission)(ok).ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := RequireRole(models.RoleEditor, models.RoleAdmin)(ok)
+
+	tests := []struct {
+		role           models.Role
+		expectedStatus int
+	}{
+		{role: models.RoleReader, expectedStatus: http.StatusForbidden},
+		{role: models.RoleAuthor, expectedStatus: http.StatusForbidden},
+		{role: models.RoleEditor, expectedStatus: http.StatusOK},
+		{role: models.RoleAdmin, expectedStatus: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.role), func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/admin/users", nil)
+			req = req.WithContext(context.WithValue(req.Context(), RoleKey, tc.role))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		role           models.Role
+		scopes         []models.Scope
+		permission     models.Permission
+		expectedStatus int
+	}{
+		{name: "Scope grants permission", role: models.RoleAuthor, scopes: []models.Scope{models.ScopeBlogsWrite}, permission: models.PermBlogsCreate, expectedStatus: http.StatusOK},
+		{name: "Missing scope", role: models.RoleAuthor, scopes: []models.Scope{models.ScopeBlogsRead}, permission: models.PermBlogsCreate, expectedStatus: http.StatusForbidden},
+		{name: "Scope does not extend the role", role: models.RoleReader, scopes: []models.Scope{models.ScopeBlogsWrite}, permission: models.PermBlogsCreate, expectedStatus: http.StatusForbidden},
+		{name: "No scope covers user management", role: models.RoleAdmin, scopes: []models.Scope{models.ScopeUserRead, models.ScopeUserWrite}, permission: models.PermUsersManage, expectedStatus: http.StatusForbidden},
+		{name: "Login token is not limited", role: models.RoleAuthor, scopes: nil, permission: models.PermBlogsCreate, expectedStatus: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/user/blog", nil)
+			ctx := context.WithValue(req.Context(), RoleKey, tc.role)
+			if tc.scopes != nil {
+				ctx = context.WithValue(ctx, ScopesKey, tc.scopes)
+			}
+			rr := httptest.NewRecorder()
+
+			RequirePermission(tc.permission)(ok).ServeHTTP(rr, req.WithContext(ctx))
+
+			if status := rr.Code; status != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatus)
+			}
+		})
+	}
+
+	t.Run("Account management needs a login token", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/logout", nil)
+		req = req.WithContext(context.WithValue(req.Context(), ScopesKey, []models.Scope{models.ScopeUserWrite}))
+		rr := httptest.NewRecorder()
+
+		DenyPersonalAccessTokens(ok).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusForbidden {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusForbidden)
+		}
+	})
+}
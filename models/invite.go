@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invite lets people register while registration is invite-only. Like
+// personal access tokens, only the SHA-256 hash of the code is stored and
+// Prefix keeps its first characters for telling invites apart.
+type Invite struct {
+	gorm.Model
+	CreatedByID uint      `gorm:"index;not null"`
+	Prefix      string    `gorm:"size:16;not null"`
+	CodeHash    string    `gorm:"uniqueIndex;not null"`
+	MaxUses     int       `gorm:"not null"`
+	Uses        int       `gorm:"not null;default:0"`
+	ExpiresAt   time.Time `gorm:"not null"`
+}
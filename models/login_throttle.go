@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginThrottle counts recent failed logins for one account or client IP.
+// Key is "user:<id>" or "ip:<address>".
+type LoginThrottle struct {
+	Key           string    `gorm:"primaryKey;size:80"`
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"index;not null"`
+	LockedUntil   *time.Time
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OIDCIdentity links a user to an account at an OpenID Connect provider,
+// which is identified by the issuer and its subject identifier
+type OIDCIdentity struct {
+	gorm.Model
+	UserID      uint   `gorm:"index;not null"`
+	Issuer      string `gorm:"uniqueIndex:idx_oidc_identities_issuer_subject;not null"`
+	Subject     string `gorm:"uniqueIndex:idx_oidc_identities_issuer_subject;not null"`
+	Email       string
+	LastLoginAt *time.Time
+}
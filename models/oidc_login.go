@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// OIDCLogin keeps the secrets of an OIDC login in progress on the server. It
+// is found by the SHA-256 hash of the login's state and deleted when redeemed.
+type OIDCLogin struct {
+	ID           uint      `gorm:"primaryKey"`
+	StateHash    string    `gorm:"uniqueIndex;not null"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"index;not null"`
+	CreatedAt    time.Time
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PersonalAccessToken is a long-lived API credential for scripts. Only the
+// SHA-256 hash of the token is stored; Prefix keeps its first characters so
+// users can tell their tokens apart.
+type PersonalAccessToken struct {
+	gorm.Model
+	UserID     uint      `gorm:"index;not null"`
+	Name       string    `gorm:"size:64;not null"`
+	Prefix     string    `gorm:"size:16;not null"`
+	TokenHash  string    `gorm:"uniqueIndex;not null"`
+	Scopes     string    `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	LastUsedAt *time.Time
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCode is a one-time code that replaces a TOTP code when the
+// authenticator is lost. Only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash string     `gorm:"index;not null" json:"-"`
+	UsedAt   *time.Time `json:"used_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken is a single link in a rotation chain. Only the SHA-256 hash of
+// the opaque token is stored; every token issued from one login shares a FamilyID.
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	FamilyID  string     `gorm:"index;not null" json:"family_id"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
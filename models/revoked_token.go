@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RevokedToken records the jti of an access token that was logged out before
+// it expired. Rows are pruned once ExpiresAt has passed.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey" json:"jti"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
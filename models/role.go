@@ -0,0 +1,59 @@
+package models
+
+// Role is the coarse-grained access level of a user
+type Role string
+
+const (
+	RoleReader Role = "reader"
+	RoleAuthor Role = "author"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+// Permission names a single action guarded by the permission matrix.
+// "own" permissions apply to resources the caller owns, "any" to everyone's.
+type Permission string
+
+const (
+	PermBlogsRead      Permission = "blogs:read"
+	PermBlogsCreate    Permission = "blogs:create"
+	PermBlogsUpdateOwn Permission = "blogs:update:own"
+	PermBlogsUpdateAny Permission = "blogs:update:any"
+	PermBlogsDeleteOwn Permission = "blogs:delete:own"
+	PermBlogsDeleteAny Permission = "blogs:delete:any"
+	PermUsersRead      Permission = "users:read"
+	PermUsersUpdateOwn Permission = "users:update:own"
+	PermUsersUpdateAny Permission = "users:update:any"
+	PermUsersManage    Permission = "users:manage"
+	PermInvitesCreate  Permission = "invites:create"
+)
+
+// rolePermissions is the permission matrix; each role includes everything granted to the roles before it
+var rolePermissions = map[Role][]Permission{
+	RoleReader: {PermBlogsRead, PermUsersRead, PermUsersUpdateOwn, PermInvitesCreate},
+	RoleAuthor: {PermBlogsRead, PermUsersRead, PermUsersUpdateOwn, PermInvitesCreate,
+		PermBlogsCreate, PermBlogsUpdateOwn, PermBlogsDeleteOwn},
+	RoleEditor: {PermBlogsRead, PermUsersRead, PermUsersUpdateOwn, PermInvitesCreate,
+		PermBlogsCreate, PermBlogsUpdateOwn, PermBlogsDeleteOwn,
+		PermBlogsUpdateAny, PermBlogsDeleteAny},
+	RoleAdmin: {PermBlogsRead, PermUsersRead, PermUsersUpdateOwn, PermInvitesCreate,
+		PermBlogsCreate, PermBlogsUpdateOwn, PermBlogsDeleteOwn,
+		PermBlogsUpdateAny, PermBlogsDeleteAny,
+		PermUsersUpdateAny, PermUsersManage},
+}
+
+// Valid reports whether r is one of the known roles
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role is granted the permission
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
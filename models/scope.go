@@ -0,0 +1,61 @@
+package models
+
+import "strings"
+
+// Scope limits what a personal access token may do on top of its owner's role
+type Scope string
+
+const (
+	ScopeBlogsRead  Scope = "blogs:read"
+	ScopeBlogsWrite Scope = "blogs:write"
+	ScopeUserRead   Scope = "user:read"
+	ScopeUserWrite  Scope = "user:write"
+)
+
+// permissionScopes lists the scope a token needs to use each permission.
+// Permissions missing here are never available to personal access tokens.
+var permissionScopes = map[Permission]Scope{
+	PermBlogsRead:      ScopeBlogsRead,
+	PermBlogsCreate:    ScopeBlogsWrite,
+	PermBlogsUpdateOwn: ScopeBlogsWrite,
+	PermBlogsUpdateAny: ScopeBlogsWrite,
+	PermBlogsDeleteOwn: ScopeBlogsWrite,
+	PermBlogsDeleteAny: ScopeBlogsWrite,
+	PermUsersRead:      ScopeUserRead,
+	PermUsersUpdateOwn: ScopeUserWrite,
+	PermUsersUpdateAny: ScopeUserWrite,
+}
+
+// Valid reports whether s is one of the known scopes
+func (s Scope) Valid() bool {
+	switch s {
+	case ScopeBlogsRead, ScopeBlogsWrite, ScopeUserRead, ScopeUserWrite:
+		return true
+	}
+	return false
+}
+
+// Scope returns the scope a token needs for the permission
+func (p Permission) Scope() (Scope, bool) {
+	s, ok := permissionScopes[p]
+	return s, ok
+}
+
+// JoinScopes stores scopes as a space-separated list, as in OAuth
+func JoinScopes(scopes []Scope) string {
+	parts := make([]string, len(scopes))
+	for i, s := range scopes {
+		parts[i] = string(s)
+	}
+	return strings.Join(parts, " ")
+}
+
+// SplitScopes is the inverse of JoinScopes
+func SplitScopes(s string) []Scope {
+	fields := strings.Fields(s)
+	scopes := make([]Scope, len(fields))
+	for i, f := range fields {
+		scopes[i] = Scope(f)
+	}
+	return scopes
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Session is one login on one device. Its ID is also the FamilyID of the
+// refresh tokens rotated from that login and the "sid" claim of its access tokens.
+type Session struct {
+	ID         string `gorm:"primaryKey;size:64"`
+	UserID     uint   `gorm:"index;not null"`
+	Device     string `gorm:"size:64"`
+	UserAgent  string `gorm:"size:512"`
+	IP         string `gorm:"size:64"`
+	CreatedAt  time.Time
+	LastSeenAt time.Time `gorm:"index;not null"`
+	RevokedAt  *time.Time
+}
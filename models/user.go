@@ -1,16 +1,72 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
 	Username string `gorm:"uniqueIndex;not null" json:"username"`
-	Email    string `gorm:"uniqueIndex;not null" json:"email"`
-	Password string `gorm:"not null" json:"password"`
-	Blogs    []Blog `gorm:"foreignKey:UserID" json:"blogs"`
+	// Email is stored lowercased, and the index rejects addresses differing only in case
+	Email    string `gorm:"uniqueIndex:idx_users_email_lower,expression:LOWER(email);not null" json:"email"`
+	Password string `gorm:"not null" json:"-"`
+	Role     Role   `gorm:"type:varchar(16);not null;default:author" json:"role"`
+	// EmailVerifiedAt is nil until the user follows the link sent on registration
+	EmailVerifiedAt *time.Time `json:"-"`
+	// TOTPSecret is set on enrollment; two-factor login is only enforced once TOTPEnabled
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `gorm:"not null;default:false" json:"-"`
+	// TOTPLastStep is the time step of the last accepted code, which blocks replays
+	TOTPLastStep int64 `gorm:"not null;default:0" json:"-"`
+	// TokenVersion is embedded in every access token; bumping it signs the user out everywhere
+	TokenVersion uint `gorm:"not null;default:0" json:"-"`
+	// Status is pending while an admin has yet to approve the registration
+	Status UserStatus `gorm:"type:varchar(16);not null;default:active" json:"-"`
+	// InvitedByID is the user whose invite was used to register, if any
+	InvitedByID *uint `json:"-"`
+	// AuthSource names the authenticator that checks the user's password
+	AuthSource AuthSource `gorm:"type:varchar(16);not null;default:local;uniqueIndex:idx_users_external_id,where:external_id <> ''" json:"-"`
+	// ExternalID is how AuthSource names the user, such as their directory DN.
+	// Unlike Username it never changes, so it is what logins are matched on.
+	ExternalID string `gorm:"not null;default:'';uniqueIndex:idx_users_external_id" json:"-"`
+	Blogs      []Blog `gorm:"foreignKey:UserID" json:"-"`
 }
 
+// AuthSource is where a user's password is kept
+type AuthSource string
+
+const (
+	// AuthSourceLocal users have their password hash in the users table
+	AuthSourceLocal AuthSource = "local"
+	// AuthSourceLDAP users log in with their directory password
+	AuthSourceLDAP AuthSource = "ldap"
+	// AuthSourceProxy users are created when a trusted reverse proxy first names
+	// them, and are only ever authenticated by it
+	AuthSourceProxy AuthSource = "proxy"
+)
+
+// UserStatus tells whether an account may log in
+type UserStatus string
+
+const (
+	StatusActive  UserStatus = "active"
+	StatusPending UserStatus = "pending"
+)
+
+// Credentials identify a user by username or email, ignoring case
 type Credentials struct {
+	Identifier string `json:"identifier"`
+	// Username is the field clients used before Identifier and is still accepted
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
+
+// LoginIdentifier is Identifier, or Username for older clients
+func (c Credentials) LoginIdentifier() string {
+	if c.Identifier != "" {
+		return c.Identifier
+	}
+	return c.Username
+}
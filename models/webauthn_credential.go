@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebAuthnCredential is a passkey registered by a user. CredentialID is the
+// base64url credential ID chosen by the authenticator and PublicKey its COSE key.
+type WebAuthnCredential struct {
+	gorm.Model
+	UserID       uint       `gorm:"index;not null" json:"user_id"`
+	Name         string     `gorm:"size:64" json:"name"`
+	CredentialID string     `gorm:"uniqueIndex;not null" json:"credential_id"`
+	PublicKey    []byte     `gorm:"not null" json:"-"`
+	SignCount    uint32     `gorm:"not null;default:0" json:"-"`
+	AAGUID       []byte     `json:"-"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
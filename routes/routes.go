@@ -3,27 +3,83 @@ package routes
 import (
 	"Blogsite/handlers"
 	middleware "Blogsite/middlewares"
+	"Blogsite/models"
+	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
+// can wraps a handler so that it only runs for roles granted perm
+func can(perm models.Permission, h http.HandlerFunc) http.Handler {
+	return middleware.RequirePermission(perm)(h)
+}
+
 func SetupRoutes() *mux.Router {
 	r := mux.NewRouter()
 
+	r.HandleFunc("/.well-known/jwks.json", handlers.JWKS).Methods("GET")
 	r.HandleFunc("/api/register", handlers.Register).Methods("POST")
 	r.HandleFunc("/api/login", handlers.Login).Methods("POST")
+	r.HandleFunc("/api/login/2fa", handlers.LoginTwoFactor).Methods("POST")
+	r.HandleFunc("/api/login/magic", handlers.RequestMagicLink).Methods("POST")
+	r.HandleFunc("/api/login/magic/verify", handlers.MagicLinkLogin).Methods("POST")
+	r.HandleFunc("/api/login/passkey/begin", handlers.BeginPasskeyLogin).Methods("POST")
+	r.HandleFunc("/api/login/passkey/finish", handlers.FinishPasskeyLogin).Methods("POST")
+	r.HandleFunc("/api/login/oidc/begin", handlers.BeginOIDCLogin).Methods("POST")
+	r.HandleFunc("/api/login/oidc/finish", handlers.FinishOIDCLogin).Methods("POST")
+	r.HandleFunc("/api/token/refresh", handlers.RefreshToken).Methods("POST")
+	r.HandleFunc("/api/verify-email", handlers.VerifyEmail).Methods("GET", "POST")
+	r.HandleFunc("/api/verify-email/resend", handlers.ResendVerification).Methods("POST")
+	r.HandleFunc("/api/password/forgot", handlers.ForgotPassword).Methods("POST")
+	r.HandleFunc("/api/password/reset", handlers.ResetPassword).Methods("POST")
 
 	s := r.PathPrefix("/api").Subrouter()
 	s.Use(middleware.AuthMiddleware)
 
-	s.HandleFunc("/user/blog", handlers.CreateBlog).Methods("POST")
-	s.HandleFunc("/feed", handlers.GetAllBlogs).Methods("GET")
-	s.HandleFunc("/user/blogs", handlers.GetUserBlogs).Methods("GET")
-	s.HandleFunc("/blog/{id}", handlers.GetBlogById).Methods("GET")
-	s.HandleFunc("/user/{id}", handlers.GetUser).Methods("GET")
-	s.HandleFunc("/user/{id}", handlers.UpdateUser).Methods("PUT")
+	// Account management is not available to personal access tokens
+	account := s.NewRoute().Subrouter()
+	account.Use(middleware.DenyPersonalAccessTokens)
+
+	account.HandleFunc("/logout", handlers.Logout).Methods("POST")
+	account.HandleFunc("/logout/all", handlers.LogoutAll).Methods("POST")
+	account.HandleFunc("/user", handlers.DeleteAccount).Methods("DELETE")
+	account.HandleFunc("/user/export", handlers.ExportUserData).Methods("GET")
+	account.HandleFunc("/user/2fa/enroll", handlers.EnrollTOTP).Methods("POST")
+	account.HandleFunc("/user/2fa/confirm", handlers.ConfirmTOTP).Methods("POST")
+	account.HandleFunc("/user/2fa/disable", handlers.DisableTOTP).Methods("POST")
+	account.HandleFunc("/user/passkeys", handlers.GetPasskeys).Methods("GET")
+	account.HandleFunc("/user/passkeys/register/begin", handlers.BeginPasskeyRegistration).Methods("POST")
+	account.HandleFunc("/user/passkeys/register/finish", handlers.FinishPasskeyRegistration).Methods("POST")
+	account.HandleFunc("/user/passkeys/{id}", handlers.DeletePasskey).Methods("DELETE")
+	account.HandleFunc("/user/password", handlers.ChangePassword).Methods("PUT")
+	account.Handle("/user/invites", can(models.PermInvitesCreate, handlers.GetInvites)).Methods("GET")
+	account.Handle("/user/invites", can(models.PermInvitesCreate, handlers.CreateInvite)).Methods("POST")
+	account.Handle("/user/invites/{id}", can(models.PermInvitesCreate, handlers.DeleteInvite)).Methods("DELETE")
+	account.HandleFunc("/user/sessions", handlers.GetSessions).Methods("GET")
+	account.HandleFunc("/user/sessions", handlers.LogoutAll).Methods("DELETE")
+	account.HandleFunc("/user/sessions/{id}", handlers.RevokeSession).Methods("DELETE")
+	account.HandleFunc("/user/tokens", handlers.GetPersonalAccessTokens).Methods("GET")
+	account.HandleFunc("/user/tokens", handlers.CreatePersonalAccessToken).Methods("POST")
+	account.HandleFunc("/user/tokens/{id}", handlers.DeletePersonalAccessToken).Methods("DELETE")
+
+	s.Handle("/user/blog", can(models.PermBlogsCreate, handlers.CreateBlog)).Methods("POST")
+	s.Handle("/feed", can(models.PermBlogsRead, handlers.GetAllBlogs)).Methods("GET")
+	s.Handle("/user/blogs", can(models.PermBlogsRead, handlers.GetUserBlogs)).Methods("GET")
+	s.Handle("/blog/{id}", can(models.PermBlogsRead, handlers.GetBlogById)).Methods("GET")
+	s.Handle("/user/{id}", can(models.PermUsersRead, handlers.GetUser)).Methods("GET")
+	s.Handle("/user/{id}", can(models.PermUsersUpdateOwn, handlers.UpdateUser)).Methods("PUT")
 	s.HandleFunc("/user/blog/{id}", handlers.UpdateBlog).Methods("PUT")
 	s.HandleFunc("/user/blog/{id}", handlers.DeleteBlog).Methods("DELETE")
 
+	admin := s.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.DenyPersonalAccessTokens, middleware.RequireRole(models.RoleAdmin))
+
+	admin.HandleFunc("/users/pending", handlers.GetPendingUsers).Methods("GET")
+	admin.HandleFunc("/users/{id}/approve", handlers.ApproveUser).Methods("POST")
+	admin.HandleFunc("/users/{id}/reject", handlers.RejectUser).Methods("POST")
+	admin.HandleFunc("/users/{id}/role", handlers.SetUserRole).Methods("PUT")
+	admin.HandleFunc("/users/{id}/lockout", handlers.UnlockUser).Methods("DELETE")
+	admin.HandleFunc("/users/{id}/restore", handlers.RestoreUser).Methods("POST")
+
 	return r
 }
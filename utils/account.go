@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// userOwnedModels lists every table with rows belonging to a user, all of
+// which go when the account is purged
+var userOwnedModels = []interface{}{
+	&models.Blog{},
+	&models.RefreshToken{},
+	&models.RevokedToken{},
+	&models.PasswordResetToken{},
+	&models.RecoveryCode{},
+	&models.WebAuthnCredential{},
+	&models.PersonalAccessToken{},
+	&models.Session{},
+	&models.OIDCIdentity{},
+}
+
+// PurgeDeletedAccounts permanently removes accounts deleted more than
+// config.Auth.AccountDeletionGracePeriod ago, along with their data
+func PurgeDeletedAccounts(now time.Time) error {
+	var ids []uint
+	if err := config.DB.Unscoped().Model(&models.User{}).
+		Where("deleted_at < ?", now.Add(-config.Auth.AccountDeletionGracePeriod)).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := PurgeAccount(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeAccount permanently removes a user and everything that belongs to them
+func PurgeAccount(userID uint) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range userOwnedModels {
+			if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Where("created_by_id = ?", userID).Delete(&models.Invite{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.User{}).Where("invited_by_id = ?", userID).Update("invited_by_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("key = ?", AccountThrottleKey(userID)).Delete(&models.LoginThrottle{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.User{}, userID).Error
+	})
+}
+
+// StartAccountPurging runs PurgeDeletedAccounts every interval until the context is cancelled
+func StartAccountPurging(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, "deleted accounts", PurgeDeletedAccounts)
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	hashPrefixLength = 5
+	sha1HexLength    = 40
+)
+
+// BreachedPasswords holds SHA-1 hashes of leaked passwords, grouped by their
+// first five hex characters like the Pwned Passwords range API. Checking a
+// password never needs the network, but the whole list lives in memory, so
+// load a trimmed list such as the most common few million hashes.
+type BreachedPasswords struct {
+	// ranges maps a hash prefix to the sorted suffixes sharing it
+	ranges map[string][]string
+	size   int
+}
+
+// LoadBreachedPasswords reads path, which is either a file of full hashes,
+// one "HASH[:COUNT]" per line, or a directory of range files named after
+// their prefix ("ABCDE" or "ABCDE.txt") holding "SUFFIX[:COUNT]" lines, as
+// the range API returns them
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &BreachedPasswords{ranges: make(map[string][]string)}
+	if !info.IsDir() {
+		if err := list.readFile(path, ""); err != nil {
+			return nil, err
+		}
+		list.sort()
+		return list, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		prefix := strings.ToUpper(strings.TrimSuffix(entry.Name(), ".txt"))
+		if entry.IsDir() || len(prefix) != hashPrefixLength || !isHex(prefix) {
+			continue
+		}
+		if err := list.readFile(filepath.Join(path, entry.Name()), prefix); err != nil {
+			return nil, err
+		}
+	}
+	list.sort()
+	return list, nil
+}
+
+// readFile adds the hashes in path. With a prefix, lines hold only the rest
+// of each hash.
+func (b *BreachedPasswords) readFile(path, prefix string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := b.read(f, prefix); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (b *BreachedPasswords) read(r io.Reader, prefix string) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		hash, _, _ := strings.Cut(text, ":")
+		hash = strings.ToUpper(prefix + hash)
+		if len(hash) != sha1HexLength || !isHex(hash) {
+			return fmt.Errorf("line %d: not a SHA-1 hash", line)
+		}
+		b.ranges[hash[:hashPrefixLength]] = append(b.ranges[hash[:hashPrefixLength]], hash[hashPrefixLength:])
+		b.size++
+	}
+	return scanner.Err()
+}
+
+func (b *BreachedPasswords) sort() {
+	for _, suffixes := range b.ranges {
+		sort.Strings(suffixes)
+	}
+}
+
+// Len is the number of hashes loaded
+func (b *BreachedPasswords) Len() int {
+	return b.size
+}
+
+// Contains reports whether password appears in the list
+func (b *BreachedPasswords) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes := b.ranges[hash[:hashPrefixLength]]
+	i := sort.SearchStrings(suffixes, hash[hashPrefixLength:])
+	return i < len(suffixes) && suffixes[i] == hash[hashPrefixLength:]
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789ABCDEFabcdef", r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,359 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningKey is one entry of the key set. Keys without a private half can
+// only verify tokens, which is how a retiring key is kept around after rotation.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// CanSign reports whether the private half of the key is available
+func (k *SigningKey) CanSign() bool {
+	return k.signKey != nil
+}
+
+// KeySet holds every key accepted for verification and the one used for signing
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// algorithms lists the signing algorithms of the configured keys, which are
+// the only ones ParseJWTClaims accepts
+func (ks *KeySet) algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, key := range ks.keys {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algs = append(algs, key.Algorithm)
+		}
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+var (
+	keysMu  sync.RWMutex
+	keySet  *KeySet
+	keyOnce sync.Once
+)
+
+// ErrNoSigningKeys is returned by LoadKeySet when no key is configured
+var ErrNoSigningKeys = errors.New("no JWT signing keys configured, set JWT_KEYS_DIR or JWT_SECRET")
+
+// InitKeys loads the signing keys from configuration. It is called at startup so
+// that a broken key file stops the server instead of failing the first login.
+// Without any keys it only starts if config.Auth.JWTEphemeralKey allows a
+// throwaway key, since tokens signed with it do not survive a restart.
+func InitKeys() error {
+	ks, err := LoadKeySet(config.Auth.JWTKeysDir, config.Auth.JWTSecret, config.Auth.JWTActiveKeyID)
+	if errors.Is(err, ErrNoSigningKeys) && config.Auth.JWTEphemeralKey {
+		log.Println("WARNING: no JWT signing keys configured, signing with an ephemeral Ed25519 key; tokens will not survive a restart")
+		ks, err = ephemeralKeySet()
+	}
+	if err != nil {
+		return err
+	}
+	SetKeySet(ks)
+	return nil
+}
+
+// ephemeralKeySet returns a key set with a single new Ed25519 key
+func ephemeralKeySet() (*KeySet, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	suffix, err := GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	key := &SigningKey{ID: "ephemeral-" + suffix[:8], Algorithm: SigningMethodEdDSA.Alg(), signKey: priv, verifyKey: priv.Public()}
+	return &KeySet{active: key, keys: map[string]*SigningKey{key.ID: key}}, nil
+}
+
+// SetKeySet replaces the key set used to sign and verify tokens
+func SetKeySet(ks *KeySet) {
+	keysMu.Lock()
+	keySet = ks
+	keysMu.Unlock()
+}
+
+func currentKeySet() *KeySet {
+	keyOnce.Do(func() {
+		keysMu.RLock()
+		loaded := keySet != nil
+		keysMu.RUnlock()
+		if !loaded {
+			if err := InitKeys(); err != nil {
+				log.Fatalf("Failed to load JWT signing keys: %v", err)
+			}
+		}
+	})
+
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return keySet
+}
+
+// LoadKeySet builds a key set from a directory of key files and/or a shared secret.
+//
+// Files in dir are named after their key ID: "<kid>.pem" holds an RSA or Ed25519
+// key in PEM form (private keys sign and verify, public keys only verify) and
+// "<kid>.secret" holds an HS256 secret. A non-empty secret adds an HS256 key with
+// ID "default". With neither, it returns ErrNoSigningKeys.
+func LoadKeySet(dir, secret, activeID string) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*SigningKey)}
+
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			ext := filepath.Ext(entry.Name())
+			if ext != ".pem" && ext != ".secret" {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+
+			kid := strings.TrimSuffix(entry.Name(), ext)
+			var key *SigningKey
+			if ext == ".secret" {
+				key, err = NewHMACKey(kid, []byte(strings.TrimSpace(string(data))))
+			} else {
+				key, err = ParsePEMKey(kid, data)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+			}
+			ks.keys[kid] = key
+		}
+	}
+
+	if secret != "" {
+		key, err := NewHMACKey("default", []byte(secret))
+		if err != nil {
+			return nil, err
+		}
+		ks.keys[key.ID] = key
+	}
+
+	if len(ks.keys) == 0 {
+		return nil, ErrNoSigningKeys
+	}
+
+	if activeID == "" {
+		// Without an explicit choice, sign with the only key that can
+		for _, key := range ks.keys {
+			if key.CanSign() {
+				if ks.active != nil {
+					return nil, errors.New("several signing keys configured, set JWT_ACTIVE_KID")
+				}
+				ks.active = key
+			}
+		}
+		if ks.active == nil {
+			return nil, errors.New("no private signing key configured")
+		}
+		return ks, nil
+	}
+
+	active, ok := ks.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q not found", activeID)
+	}
+	if !active.CanSign() {
+		return nil, fmt.Errorf("active key %q has no private key", activeID)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+// NewHMACKey returns an HS256 key; secrets shorter than 32 bytes are rejected
+func NewHMACKey(kid string, secret []byte) (*SigningKey, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("HS256 secret must be at least 32 bytes")
+	}
+	return &SigningKey{ID: kid, Algorithm: jwt.SigningMethodHS256.Alg(), signKey: secret, verifyKey: secret}, nil
+}
+
+// ParsePEMKey reads an RSA or Ed25519 private or public key
+func ParsePEMKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: kid, Algorithm: jwt.SigningMethodRS256.Alg(), signKey: k, verifyKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &SigningKey{ID: kid, Algorithm: jwt.SigningMethodRS256.Alg(), verifyKey: k}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: kid, Algorithm: SigningMethodEdDSA.Alg(), signKey: k, verifyKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{ID: kid, Algorithm: SigningMethodEdDSA.Alg(), verifyKey: k}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", parsed)
+}
+
+// signToken signs the claims with the active key and sets the kid header
+func signToken(claims jwt.Claims) (string, error) {
+	key := currentKeySet().active
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
+
+// verificationKey resolves the key named by the token's kid header. The token's
+// alg must match the algorithm of that key, so an RSA public key can never be
+// used as an HMAC secret.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := currentKeySet().keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+// JWK is the public half of a signing key in RFC 7517 form
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// PublicJWKs returns every asymmetric verification key, sorted by key ID.
+// HS256 secrets are never published.
+func PublicJWKs() []JWK {
+	ks := currentKeySet()
+	jwks := []JWK{}
+	for _, key := range ks.keys {
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Algorithm,
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Algorithm,
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].KeyID < jwks[j].KeyID })
+	return jwks
+}
+
+// SigningMethodEdDSA implements the EdDSA (Ed25519) algorithm, which jwt-go lacks
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+type signingMethodEdDSA struct{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	priv, ok := key.(crypto.Signer)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	if _, ok := priv.Public().(ed25519.PublicKey); !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	sig, err := priv.Sign(rand.Reader, []byte(signingString), crypto.Hash(0))
+	if err != nil {
+		return "", err
+	}
+	return jwt.EncodeSegment(sig), nil
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, []byte(signingString), sig) {
+		return errors.New("ed25519: verification error")
+	}
+	return nil
+}
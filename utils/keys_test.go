@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"gorm.io/gorm"
+)
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+}
+
+func TestInitKeysWithoutKeys(t *testing.T) {
+	previous := config.Auth
+	defer func() { config.Auth = previous }()
+	config.Auth.JWTKeysDir, config.Auth.JWTSecret, config.Auth.JWTActiveKeyID = "", "", ""
+
+	config.Auth.JWTEphemeralKey = false
+	if err := InitKeys(); !errors.Is(err, ErrNoSigningKeys) {
+		t.Fatalf("Expected starting without keys to fail, got %v", err)
+	}
+
+	config.Auth.JWTEphemeralKey = true
+	if err := InitKeys(); err != nil {
+		t.Fatalf("Expected an ephemeral key when allowed, got %v", err)
+	}
+	if _, err := GenerateJWT(models.User{Model: gorm.Model{ID: 42}, Role: models.RoleAuthor}); err != nil {
+		t.Errorf("Failed to sign with the ephemeral key: %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	user := models.User{Model: gorm.Model{ID: 42}, Role: models.RoleAuthor}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	writePEM(t, filepath.Join(dir, "2024-rsa.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	ks, err := LoadKeySet(dir, "", "")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+	SetKeySet(ks)
+
+	oldToken, err := GenerateJWT(user)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	// Rotate: add an Ed25519 key and keep only the public half of the RSA key
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal Ed25519 key: %v", err)
+	}
+	writePEM(t, filepath.Join(dir, "2025-ed.pem"), "PRIVATE KEY", edDER)
+	rsaPub, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal RSA public key: %v", err)
+	}
+	writePEM(t, filepath.Join(dir, "2024-rsa.pem"), "PUBLIC KEY", rsaPub)
+
+	if _, err := LoadKeySet(dir, "", "2024-rsa"); err == nil {
+		t.Fatalf("Expected a verify-only key to be rejected as the active key")
+	}
+
+	ks, err = LoadKeySet(dir, "", "2025-ed")
+	if err != nil {
+		t.Fatalf("Failed to load rotated key set: %v", err)
+	}
+	SetKeySet(ks)
+
+	newToken, err := GenerateJWT(user)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		kid   string
+		alg   string
+	}{
+		{name: "Token signed before rotation", token: oldToken, kid: "2024-rsa", alg: "RS256"},
+		{name: "Token signed after rotation", token: newToken, kid: "2025-ed", alg: "EdDSA"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			userID, err := ParseJWT(tc.token)
+			if err != nil {
+				t.Fatalf("Expected token to verify, got %v", err)
+			}
+			if userID != "42" {
+				t.Errorf("Expected user ID 42, got %v", userID)
+			}
+
+			parsed, _, err := new(jwt.Parser).ParseUnverified(tc.token, jwt.MapClaims{})
+			if err != nil {
+				t.Fatalf("Failed to decode token: %v", err)
+			}
+			if parsed.Header["kid"] != tc.kid || parsed.Method.Alg() != tc.alg {
+				t.Errorf("Expected kid %v and alg %v, got %v and %v", tc.kid, tc.alg, parsed.Header["kid"], parsed.Method.Alg())
+			}
+		})
+	}
+
+	jwks := PublicJWKs()
+	if len(jwks) != 2 || jwks[0].KeyID != "2024-rsa" || jwks[0].KeyType != "RSA" || jwks[1].KeyType != "OKP" {
+		t.Errorf("Unexpected JWKS: %+v", jwks)
+	}
+}
+
+func TestParseJWTRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal RSA public key: %v", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	dir := t.TempDir()
+	writePEM(t, filepath.Join(dir, "rsa.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	ks, err := LoadKeySet(dir, "", "")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+	SetKeySet(ks)
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		kid    string
+		key    interface{}
+	}{
+		{name: "HS256 signed with the RSA public key", method: jwt.SigningMethodHS256, kid: "rsa", key: pubPEM},
+		{name: "Unknown kid", method: jwt.SigningMethodRS256, kid: "other", key: rsaKey},
+		{name: "Unsigned token", method: jwt.SigningMethodNone, kid: "rsa", key: jwt.UnsafeAllowNoneSignatureType},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(tc.method, jwt.MapClaims{"userID": "1"})
+			token.Header["kid"] = tc.kid
+			signed, err := token.SignedString(tc.key)
+			if err != nil {
+				t.Fatalf("Failed to sign token: %v", err)
+			}
+
+			if _, err := ParseJWT(signed); err == nil {
+				t.Errorf("Expected token to be rejected")
+			}
+		})
+	}
+}
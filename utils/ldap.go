@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrLDAP = errors.New("ldap request failed")
+	// ErrLDAPInvalidCredentials is returned when the directory rejects the password
+	ErrLDAPInvalidCredentials = errors.New("ldap: invalid credentials")
+	// ErrLDAPUnknownUser means the user filter matched no entry, or more than one
+	ErrLDAPUnknownUser = errors.New("ldap: no such user")
+)
+
+func ldapError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrLDAP, fmt.Sprintf(format, args...))
+}
+
+// LDAPDirectory describes how users are found and authenticated in a directory
+type LDAPDirectory struct {
+	// URL is ldap:// or ldaps://
+	URL       string
+	StartTLS  bool
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+	// BindDN and BindPassword are the service account used to search; both
+	// empty means searching anonymously
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds the user's entry, with {username} replaced by the escaped login name
+	UserFilter        string
+	UsernameAttribute string
+	EmailAttribute    string
+	// GroupAttribute on the user's entry lists the DNs of their groups, as
+	// memberOf does. When GroupBaseDN is set, groups are searched for instead
+	// with GroupFilter, where {dn} is replaced by the user's escaped DN.
+	GroupAttribute string
+	GroupBaseDN    string
+	GroupFilter    string
+}
+
+// LDAPAccount is what the directory knows about a user who logged in
+type LDAPAccount struct {
+	DN       string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+func (d LDAPDirectory) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(d.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: d.Timeout}),
+		ldap.DialWithTLSConfig(d.TLSConfig))
+	if err != nil {
+		return nil, ldapError("connecting to %s: %v", d.URL, err)
+	}
+	if d.Timeout > 0 {
+		conn.SetTimeout(d.Timeout)
+	}
+	if d.StartTLS {
+		if err := conn.StartTLS(d.TLSConfig); err != nil {
+			conn.Close()
+			return nil, ldapError("starting TLS: %v", err)
+		}
+	}
+
+	// A rejected service account is a configuration problem, not a wrong password
+	if d.BindDN != "" {
+		if err := conn.Bind(d.BindDN, d.BindPassword); err != nil {
+			conn.Close()
+			return nil, ldapError("binding as the service account: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+// search runs a search, treating a missing base as no results
+func search(conn *ldap.Conn, baseDN string, scope int, filter string, sizeLimit int, attributes []string) ([]*ldap.Entry, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		baseDN, scope, ldap.NeverDerefAliases, sizeLimit, 0, false,
+		filter, attributes, nil,
+	))
+	switch {
+	case ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject):
+		return nil, nil
+	case ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded):
+		return result.Entries, nil
+	case err != nil:
+		return nil, ldapError("searching %s: %v", baseDN, err)
+	}
+	return result.Entries, nil
+}
+
+// Authenticate looks username up and checks password by binding as the user.
+// It returns ErrLDAPUnknownUser or ErrLDAPInvalidCredentials when the login
+// does not match, and other errors when the directory could not be asked.
+func (d LDAPDirectory) Authenticate(username, password string) (*LDAPAccount, error) {
+	// Binding with a DN and no password is an anonymous bind, which succeeds
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	filter := strings.ReplaceAll(d.UserFilter, "{username}", ldap.EscapeFilter(username))
+	entries, err := search(conn, d.BaseDN, ldap.ScopeWholeSubtree, filter, 2, d.userAttributes())
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, ErrLDAPUnknownUser
+	}
+	account, err := d.login(conn, entries[0], password)
+	if err == nil && account.Username == "" {
+		account.Username = username
+	}
+	return account, err
+}
+
+// AuthenticateDN checks password for the entry at dn, as recorded when the
+// user first logged in. Unlike the login name, the DN cannot be changed from
+// Blogsite, so it keeps naming the same directory user.
+func (d LDAPDirectory) AuthenticateDN(dn, password string) (*LDAPAccount, error) {
+	if dn == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entries, err := search(conn, dn, ldap.ScopeBaseObject, "(objectClass=*)", 1, d.userAttributes())
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, ErrLDAPUnknownUser
+	}
+	return d.login(conn, entries[0], password)
+}
+
+func (d LDAPDirectory) userAttributes() []string {
+	var attributes []string
+	for _, attr := range []string{d.UsernameAttribute, d.EmailAttribute, d.GroupAttribute} {
+		if attr != "" {
+			attributes = append(attributes, attr)
+		}
+	}
+	return attributes
+}
+
+// login binds as entry with password and collects the account's details
+func (d LDAPDirectory) login(conn *ldap.Conn, entry *ldap.Entry, password string) (*LDAPAccount, error) {
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, ldapError("binding as %s: %v", entry.DN, err)
+	}
+
+	account := &LDAPAccount{
+		DN:       entry.DN,
+		Username: entry.GetAttributeValue(d.UsernameAttribute),
+		Email:    entry.GetAttributeValue(d.EmailAttribute),
+		Groups:   entry.GetAttributeValues(d.GroupAttribute),
+	}
+
+	if d.GroupBaseDN != "" {
+		// The user may not be allowed to read groups, so search as the service account again
+		if d.BindDN != "" {
+			if err := conn.Bind(d.BindDN, d.BindPassword); err != nil {
+				return nil, ldapError("binding as the service account: %v", err)
+			}
+		} else if err := conn.UnauthenticatedBind(""); err != nil {
+			return nil, ldapError("binding anonymously: %v", err)
+		}
+		filter := strings.ReplaceAll(d.GroupFilter, "{dn}", ldap.EscapeFilter(entry.DN))
+		groups, err := search(conn, d.GroupBaseDN, ldap.ScopeWholeSubtree, filter, 0, []string{"1.1"}) // no attributes, only the DNs
+		if err != nil {
+			return nil, err
+		}
+		account.Groups = nil
+		for _, group := range groups {
+			account.Groups = append(account.Groups, group.DN)
+		}
+	}
+	return account, nil
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"Blogsite/utils/ldaptest"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLDAPDirectoryAuthenticate(t *testing.T) {
+	server := ldaptest.NewServer(
+		ldaptest.Entry{DN: "cn=reader,dc=example,dc=com", Password: "service-secret"},
+		ldaptest.Entry{DN: "uid=jdoe,ou=people,dc=example,dc=com", Password: "directory-pass", Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"jdoe"},
+			"mail":        {"jdoe@example.com"},
+			"memberOf":    {"cn=editors,ou=groups,dc=example,dc=com"},
+		}},
+		ldaptest.Entry{DN: "uid=other,ou=people,dc=example,dc=com", Password: "other-pass", Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"other"},
+		}},
+		ldaptest.Entry{DN: "cn=admins,ou=groups,dc=example,dc=com", Attributes: map[string][]string{
+			"member": {"uid=jdoe,ou=people,dc=example,dc=com"},
+		}},
+	)
+	defer server.Close()
+
+	directory := LDAPDirectory{
+		URL:               server.URL,
+		Timeout:           5 * time.Second,
+		BindDN:            "cn=reader,dc=example,dc=com",
+		BindPassword:      "service-secret",
+		BaseDN:            "ou=people,dc=example,dc=com",
+		UserFilter:        "(&(objectClass=person)(uid={username}))",
+		UsernameAttribute: "uid",
+		EmailAttribute:    "mail",
+		GroupAttribute:    "memberOf",
+	}
+
+	account, err := directory.Authenticate("jdoe", "directory-pass")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	want := &LDAPAccount{
+		DN:       "uid=jdoe,ou=people,dc=example,dc=com",
+		Username: "jdoe",
+		Email:    "jdoe@example.com",
+		Groups:   []string{"cn=editors,ou=groups,dc=example,dc=com"},
+	}
+	if !reflect.DeepEqual(account, want) {
+		t.Errorf("Expected %+v, got %+v", want, account)
+	}
+
+	if _, err := directory.Authenticate("jdoe", "wrong"); !errors.Is(err, ErrLDAPInvalidCredentials) {
+		t.Errorf("Expected a wrong password to be rejected, got %v", err)
+	}
+	if _, err := directory.Authenticate("nobody", "directory-pass"); !errors.Is(err, ErrLDAPUnknownUser) {
+		t.Errorf("Expected an unknown user, got %v", err)
+	}
+	// Filter syntax in the login name is escaped rather than matching both people
+	for _, name := range []string{"*", "jdoe)(uid=*", `*\`} {
+		if _, err := directory.Authenticate(name, "directory-pass"); !errors.Is(err, ErrLDAPUnknownUser) {
+			t.Errorf("Expected %q to match nobody, got %v", name, err)
+		}
+	}
+
+	// The DN recorded at the first login keeps working without the filter
+	if account, err := directory.AuthenticateDN("uid=jdoe,ou=people,dc=example,dc=com", "directory-pass"); err != nil || !reflect.DeepEqual(account, want) {
+		t.Errorf("Expected %+v from the DN, got %+v, %v", want, account, err)
+	}
+	if _, err := directory.AuthenticateDN("uid=jdoe,ou=people,dc=example,dc=com", "other-pass"); !errors.Is(err, ErrLDAPInvalidCredentials) {
+		t.Errorf("Expected another user's password to be rejected, got %v", err)
+	}
+	if _, err := directory.AuthenticateDN("uid=gone,ou=people,dc=example,dc=com", "directory-pass"); !errors.Is(err, ErrLDAPUnknownUser) {
+		t.Errorf("Expected a removed entry to be unknown, got %v", err)
+	}
+
+	// Groups can also be searched for instead of read from memberOf
+	grouped := directory
+	grouped.GroupBaseDN = "ou=groups,dc=example,dc=com"
+	grouped.GroupFilter = "(member={dn})"
+	account, err = grouped.Authenticate("jdoe", "directory-pass")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if !reflect.DeepEqual(account.Groups, []string{"cn=admins,ou=groups,dc=example,dc=com"}) {
+		t.Errorf("Unexpected groups %v", account.Groups)
+	}
+
+	// A broken service account must not look like a wrong user password
+	misconfigured := directory
+	misconfigured.BindPassword = "wrong"
+	if _, err := misconfigured.Authenticate("jdoe", "directory-pass"); !errors.Is(err, ErrLDAP) || errors.Is(err, ErrLDAPInvalidCredentials) {
+		t.Errorf("Expected a directory error, got %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+// Package ldaptest provides an in-process LDAP server for tests, in the
+// spirit of net/http/httptest. It understands simple binds and subtree
+// searches over a fixed set of entries, and nothing else.
+package ldaptest
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// Entry is one object in the directory. Entries with a Password can bind.
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server is a directory listening on a local port
+type Server struct {
+	// URL is ldap://127.0.0.1:port
+	URL string
+
+	listener net.Listener
+	entries  []Entry
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex
+	binds []string
+}
+
+// NewServer starts a directory holding entries
+func NewServer(entries ...Entry) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("ldaptest: failed to listen: " + err.Error())
+	}
+	s := &Server{URL: "ldap://" + listener.Addr().String(), listener: listener, entries: entries}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return s
+}
+
+// Close stops the server and waits for open connections to finish
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// Binds lists the DNs of every successful bind so far, "" for anonymous ones
+func (s *Server) Binds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+// LDAP protocol operations, RFC 4511 section 4.2 onwards
+const (
+	opBindRequest    = 0
+	opBindResponse   = 1
+	opUnbindRequest  = 2
+	opSearchRequest  = 3
+	opSearchEntry    = 4
+	opSearchDone     = 5
+	opExtendedResult = 24
+)
+
+// scopeBaseObject limits a search to the base entry itself
+const scopeBaseObject = 0
+
+// LDAP result codes
+const (
+	resultSuccess            = 0
+	resultProtocolError      = 2
+	resultInvalidCredentials = 49
+)
+
+// text is the content of a primitive element, whatever its class
+func text(p *ber.Packet) string {
+	return p.Data.String()
+}
+
+func number(p *ber.Packet) int {
+	n, _ := p.Value.(int64)
+	return int(n)
+}
+
+func octetString(s string) *ber.Packet {
+	return ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, s, "")
+}
+
+func result(op ber.Tag, code int, message string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, op, nil, "")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	p.AppendChild(octetString(""))
+	p.AppendChild(octetString(message))
+	return p
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		message, err := ber.ReadPacket(conn)
+		if err != nil || len(message.Children) < 2 {
+			return
+		}
+		id := number(message.Children[0])
+		reply := func(op *ber.Packet) {
+			envelope := ber.NewSequence("")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+			envelope.AppendChild(op)
+			conn.Write(envelope.Bytes())
+		}
+
+		switch op := message.Children[1]; op.Tag {
+		case opBindRequest:
+			if len(op.Children) < 3 {
+				return
+			}
+			reply(result(opBindResponse, s.bind(text(op.Children[1]), text(op.Children[2])), ""))
+		case opSearchRequest:
+			for _, entry := range s.search(op.Children) {
+				reply(entry)
+			}
+			reply(result(opSearchDone, resultSuccess, ""))
+		case opUnbindRequest:
+			return
+		default:
+			reply(result(opExtendedResult, resultProtocolError, "operation not supported"))
+		}
+	}
+}
+
+func (s *Server) bind(dn, password string) int {
+	if dn != "" {
+		entry := s.find(dn)
+		if entry == nil || entry.Password == "" || entry.Password != password {
+			return resultInvalidCredentials
+		}
+	}
+	s.mu.Lock()
+	s.binds = append(s.binds, dn)
+	s.mu.Unlock()
+	return resultSuccess
+}
+
+func (s *Server) find(dn string) *Entry {
+	for i := range s.entries {
+		if strings.EqualFold(s.entries[i].DN, dn) {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) search(fields []*ber.Packet) []*ber.Packet {
+	if len(fields) < 8 {
+		return nil
+	}
+	base := strings.ToLower(text(fields[0]))
+	baseOnly := number(fields[1]) == scopeBaseObject
+	sizeLimit := number(fields[3])
+	filter := fields[6]
+
+	var wanted []string
+	for _, attr := range fields[7].Children {
+		wanted = append(wanted, text(attr))
+	}
+
+	var results []*ber.Packet
+	for _, entry := range s.entries {
+		dn := strings.ToLower(entry.DN)
+		if dn != base && (baseOnly || !strings.HasSuffix(dn, ","+base)) {
+			continue
+		}
+		if !matches(filter, entry) {
+			continue
+		}
+		if sizeLimit > 0 && len(results) == sizeLimit {
+			break
+		}
+
+		attrs := ber.NewSequence("")
+		for name, values := range entry.Attributes {
+			if !selected(wanted, name) {
+				continue
+			}
+			attr := ber.NewSequence("")
+			attr.AppendChild(octetString(name))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+			for _, value := range values {
+				set.AppendChild(octetString(value))
+			}
+			attr.AppendChild(set)
+			attrs.AppendChild(attr)
+		}
+		result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchEntry, nil, "")
+		result.AppendChild(octetString(entry.DN))
+		result.AppendChild(attrs)
+		results = append(results, result)
+	}
+	return results
+}
+
+func selected(wanted []string, name string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, w := range wanted {
+		if w == "*" || strings.EqualFold(w, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func values(entry Entry, attr string) []string {
+	if strings.EqualFold(attr, "dn") {
+		return []string{entry.DN}
+	}
+	for name, values := range entry.Attributes {
+		if strings.EqualFold(name, attr) {
+			return values
+		}
+	}
+	return nil
+}
+
+// Filter choices, RFC 4511 section 4.5.1
+const (
+	filterAnd        = 0
+	filterOr         = 1
+	filterNot        = 2
+	filterEquality   = 3
+	filterSubstrings = 4
+	filterPresent    = 7
+
+	substringInitial = 0
+	substringAny     = 1
+	substringFinal   = 2
+)
+
+// matches evaluates a BER-encoded filter against entry, comparing values ignoring case
+func matches(filter *ber.Packet, entry Entry) bool {
+	switch filter.Tag {
+	case filterAnd:
+		for _, child := range filter.Children {
+			if !matches(child, entry) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, child := range filter.Children {
+			if matches(child, entry) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return len(filter.Children) == 1 && !matches(filter.Children[0], entry)
+	case filterEquality:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		for _, value := range values(entry, text(filter.Children[0])) {
+			if strings.EqualFold(value, text(filter.Children[1])) {
+				return true
+			}
+		}
+		return false
+	case filterPresent:
+		// Every real entry has an objectClass, so (objectClass=*) matches anything
+		return strings.EqualFold(text(filter), "objectClass") || len(values(entry, text(filter))) > 0
+	case filterSubstrings:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		for _, value := range values(entry, text(filter.Children[0])) {
+			if matchSubstrings(strings.ToLower(value), filter.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func matchSubstrings(value string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		s := strings.ToLower(text(part))
+		switch part.Tag {
+		case substringInitial:
+			if !strings.HasPrefix(value, s) {
+				return false
+			}
+			value = value[len(s):]
+		case substringAny:
+			i := strings.Index(value, s)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(s):]
+		case substringFinal:
+			if !strings.HasSuffix(value, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
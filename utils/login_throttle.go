@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Failed logins are counted in Postgres so every instance enforces the same
+// limits. Once a key reaches its allowance, each further failure locks it out
+// for twice as long as the previous one.
+
+// AccountThrottleKey is the throttle key of a user account
+func AccountThrottleKey(userID uint) string {
+	return "user:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// IPThrottleKey is the throttle key of a client address
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// EmailThrottleKey is the throttle key of the emails sent to a normalized address
+func EmailThrottleKey(email string) string {
+	return "email:" + email
+}
+
+// EmailIPThrottleKey is the throttle key of the emails a client address asks
+// for, kept apart from IPThrottleKey so they do not use up its logins
+func EmailIPThrottleKey(ip string) string {
+	return "email-" + IPThrottleKey(ip)
+}
+
+// ClientIP returns the address of the client. X-Forwarded-For is only
+// believed when the request comes from one of
+// config.Auth.ProxyAuthTrustedProxies, and then only up to the right-most hop
+// that is not a trusted proxy itself: anything to its left was written by the
+// client and could be forged.
+func ClientIP(r *http.Request) string {
+	client := peerIP(r)
+	if !isTrustedProxyIP(net.ParseIP(client)) {
+		return client
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip.String()
+		if !isTrustedProxyIP(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// peerIP returns the address of the directly connected client
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// lockoutDuration returns the lockout that follows the given number of
+// consecutive failures when allowed failures are free
+func lockoutDuration(failures, allowed int, base, ceiling time.Duration) time.Duration {
+	if failures < allowed {
+		return 0
+	}
+	d := base
+	for i := allowed; i < failures && d < ceiling; i++ {
+		d *= 2
+	}
+	if d > ceiling {
+		d = ceiling
+	}
+	return d
+}
+
+// LoginRetryAfter returns how long the longest active lockout among keys still lasts
+func LoginRetryAfter(now time.Time, keys ...string) (time.Duration, error) {
+	var throttles []models.LoginThrottle
+	if err := config.DB.Where("key IN ? AND locked_until > ?", keys, now).Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+
+	var longest time.Duration
+	for _, t := range throttles {
+		if d := t.LockedUntil.Sub(now); d > longest {
+			longest = d
+		}
+	}
+	return longest, nil
+}
+
+// RecordLoginFailure counts a failed login against key and returns the lockout
+// it triggered, if any. Failures are forgotten once a key has been quiet for
+// config.Auth.LoginFailureWindow after its last failure or lockout.
+func RecordLoginFailure(key string, allowed int, now time.Time) (time.Duration, error) {
+	var lockout time.Duration
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.LoginThrottle{Key: key, LastFailureAt: now}).Error; err != nil {
+			return err
+		}
+
+		var throttle models.LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&throttle).Error; err != nil {
+			return err
+		}
+
+		quietSince := throttle.LastFailureAt
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(quietSince) {
+			quietSince = *throttle.LockedUntil
+		}
+		if now.Sub(quietSince) > config.Auth.LoginFailureWindow {
+			throttle.Failures = 0
+		}
+
+		throttle.Failures++
+		throttle.LastFailureAt = now
+		lockout = lockoutDuration(throttle.Failures, allowed, config.Auth.LoginLockoutBase, config.Auth.LoginLockoutMax)
+		if lockout > 0 {
+			lockedUntil := now.Add(lockout)
+			throttle.LockedUntil = &lockedUntil
+		}
+		return tx.Save(&throttle).Error
+	})
+	return lockout, err
+}
+
+// ResetLoginFailures clears the failures and lockouts of keys
+func ResetLoginFailures(keys ...string) error {
+	return config.DB.Where("key IN ?", keys).Delete(&models.LoginThrottle{}).Error
+}
+
+// PruneLoginThrottles drops counters that RecordLoginFailure would reset anyway
+func PruneLoginThrottles(now time.Time) error {
+	cutoff := now.Add(-config.Auth.LoginFailureWindow)
+	return config.DB.
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", cutoff, cutoff).
+		Delete(&models.LoginThrottle{}).Error
+}
+
+// StartLoginThrottlePruning runs PruneLoginThrottles every interval until the context is cancelled
+func StartLoginThrottlePruning(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, "login throttles", PruneLoginThrottles)
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 1, expected: 0},
+		{failures: 4, expected: 0},
+		{failures: 5, expected: time.Minute},
+		{failures: 6, expected: 2 * time.Minute},
+		{failures: 8, expected: 8 * time.Minute},
+		{failures: 12, expected: time.Hour},
+		{failures: 1000, expected: time.Hour},
+	}
+
+	for _, tc := range tests {
+		if got := lockoutDuration(tc.failures, 5, time.Minute, time.Hour); got != tc.expected {
+			t.Errorf("lockoutDuration(%d): got %v want %v", tc.failures, got, tc.expected)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/login", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := ClientIP(r); got != "203.0.113.7" {
+		t.Errorf("got %q want %q", got, "203.0.113.7")
+	}
+
+	r.RemoteAddr = "[2001:db8::1]:443"
+	if got := ClientIP(r); got != "2001:db8::1" {
+		t.Errorf("got %q want %q", got, "2001:db8::1")
+	}
+}
+
+func TestClientIPBehindTrustedProxies(t *testing.T) {
+	previous := config.Auth
+	defer func() { config.Auth = previous }()
+	_, gateway, _ := net.ParseCIDR("10.0.0.0/24")
+	config.Auth.ProxyAuthTrustedProxies = []*net.IPNet{gateway}
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{"10.0.0.7:41000", []string{"198.51.100.1"}, "198.51.100.1"},
+		// The client can prepend anything; only the hop the gateway added counts
+		{"10.0.0.7:41000", []string{"192.0.2.99, 198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.7:41000", []string{"192.0.2.99", "198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"10.0.0.7:41000", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"10.0.0.7:41000", []string{"not-an-ip, 10.0.0.3"}, "10.0.0.3"},
+		{"10.0.0.7:41000", nil, "10.0.0.7"},
+		{"203.0.113.7:51234", []string{"198.51.100.1"}, "203.0.113.7"},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest("POST", "/api/login", nil)
+		r.RemoteAddr = tc.remoteAddr
+		for _, value := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := ClientIP(r); got != tc.expected {
+			t.Errorf("%s %v: got %q want %q", tc.remoteAddr, tc.forwarded, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"bytes"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outbound email. The auth flows only ever talk to this interface.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// DefaultMailer is the mailer used by the handlers, chosen from config.Mail at startup
+var DefaultMailer Mailer = NewMemoryMailer()
+
+// InitMailer sets DefaultMailer from configuration
+func InitMailer() error {
+	mailer, err := NewMailer(config.Mail)
+	if err != nil {
+		return err
+	}
+	DefaultMailer = mailer
+	return nil
+}
+
+// NewMailer builds the mailer selected by cfg.Driver
+func NewMailer(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mail driver")
+		}
+		return &SMTPMailer{
+			Addr:     net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+			Host:     cfg.SMTPHost,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}, nil
+	case "file":
+		if err := os.MkdirAll(cfg.OutboxDir, 0700); err != nil {
+			return nil, err
+		}
+		return &FileMailer{Dir: cfg.OutboxDir, From: cfg.From}, nil
+	case "memory":
+		return NewMemoryMailer(), nil
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+}
+
+// formatMessage renders msg as an RFC 5322 message
+func formatMessage(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// checkHeaders rejects header values that could inject extra headers
+func checkHeaders(msg Message) error {
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("invalid characters in message headers")
+	}
+	return nil
+}
+
+// SMTPMailer sends mail through an SMTP relay, using STARTTLS when offered
+type SMTPMailer struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := checkHeaders(msg); err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Addr, auth, from.Address, []string{msg.To}, formatMessage(m.From, msg))
+}
+
+// FileMailer writes every message as an .eml file into Dir, for local development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	if err := checkHeaders(msg); err != nil {
+		return err
+	}
+	suffix, err := GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), suffix[:8])
+	return os.WriteFile(filepath.Join(m.Dir, name), formatMessage(m.From, msg), 0600)
+}
+
+// MemoryMailer keeps sent messages in memory, for tests
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(msg Message) error {
+	if err := checkHeaders(msg); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.messages = append(m.messages, msg)
+	m.mu.Unlock()
+	return nil
+}
+
+// Messages returns a copy of everything sent so far
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
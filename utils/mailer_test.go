@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMailers(t *testing.T) {
+	msg := Message{To: "reader@example.com", Subject: "Hello", Body: "Line one\nLine two"}
+
+	t.Run("Memory", func(t *testing.T) {
+		mailer := NewMemoryMailer()
+		if err := mailer.Send(msg); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		if sent := mailer.Messages(); len(sent) != 1 || sent[0] != msg {
+			t.Errorf("Unexpected messages: %+v", sent)
+		}
+	})
+
+	t.Run("File outbox", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "outbox")
+		mailer, err := NewMailer(config.MailConfig{Driver: "file", OutboxDir: dir, From: "Blogsite <no-reply@example.com>"})
+		if err != nil {
+			t.Fatalf("Failed to create mailer: %v", err)
+		}
+		if err := mailer.Send(msg); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if err != nil || len(files) != 1 {
+			t.Fatalf("Expected one .eml file, got %v (%v)", files, err)
+		}
+		data, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		for _, want := range []string{"To: reader@example.com\r\n", "Subject: Hello\r\n", "Line one\r\nLine two"} {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("Message is missing %q:\n%s", want, data)
+			}
+		}
+	})
+
+	t.Run("Header injection", func(t *testing.T) {
+		mailer := NewMemoryMailer()
+		bad := Message{To: "reader@example.com\r\nBcc: victim@example.com", Subject: "Hello"}
+		if err := mailer.Send(bad); err == nil {
+			t.Errorf("Expected message with CRLF in a header to be rejected")
+		}
+	})
+
+	t.Run("Unknown driver", func(t *testing.T) {
+		if _, err := NewMailer(config.MailConfig{Driver: "carrier-pigeon"}); err == nil {
+			t.Errorf("Expected unknown driver to be rejected")
+		}
+	})
+}
@@ -0,0 +1,427 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var ErrOIDC = errors.New("oidc login failed")
+
+func oidcError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrOIDC, fmt.Sprintf(format, args...))
+}
+
+// oidcSigningAlgorithms are the ID token algorithms accepted. HMAC is left out
+// on purpose: it would make the client secret a signing key.
+var oidcSigningAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+const (
+	// oidcMaxResponseSize bounds what is read from the provider
+	oidcMaxResponseSize = 1 << 20
+	// oidcDiscoveryTTL is how long a discovered configuration is reused
+	oidcDiscoveryTTL = time.Hour
+	// oidcJWKSMinRefresh stops tokens with unknown key IDs from making every
+	// login refetch the provider's keys
+	oidcJWKSMinRefresh = time.Minute
+)
+
+// OIDCClient is this server's registration at an OpenID Connect provider
+type OIDCClient struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// HTTPClient is used for every request to the provider; nil means a client
+	// with a ten second timeout
+	HTTPClient *http.Client
+}
+
+// OIDCProvider is the part of a provider's discovery document the login needs
+type OIDCProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	discoveredAt time.Time
+
+	mu            sync.Mutex
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// IDTokenClaims are the claims of an ID token used to find or create the user
+type IDTokenClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          []string `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	ExpiresAt         int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+	Name              string   `json:"name"`
+}
+
+// Valid is a no-op so that jwt-go defers to VerifyIDToken
+func (c *IDTokenClaims) Valid() error {
+	return nil
+}
+
+// UnmarshalJSON accepts aud as a single string or an array, and
+// email_verified as a boolean or, as some providers send it, a string
+func (c *IDTokenClaims) UnmarshalJSON(data []byte) error {
+	type plain IDTokenClaims
+	aux := struct {
+		*plain
+		Audience      interface{} `json:"aud"`
+		EmailVerified interface{} `json:"email_verified"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	c.Audience = nil
+	switch aud := aux.Audience.(type) {
+	case string:
+		c.Audience = []string{aud}
+	case []interface{}:
+		for _, item := range aud {
+			if s, ok := item.(string); ok {
+				c.Audience = append(c.Audience, s)
+			}
+		}
+	}
+
+	switch verified := aux.EmailVerified.(type) {
+	case bool:
+		c.EmailVerified = verified
+	case string:
+		c.EmailVerified = verified == "true"
+	default:
+		c.EmailVerified = false
+	}
+	return nil
+}
+
+func (c *IDTokenClaims) hasAudience(value string) bool {
+	for _, aud := range c.Audience {
+		if aud == value {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	oidcProvidersMu sync.Mutex
+	oidcProviders   = make(map[string]*OIDCProvider)
+)
+
+func (c OIDCClient) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// getJSON fetches url and decodes its JSON body into v
+func (c OIDCClient) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseSize)).Decode(v)
+}
+
+// Provider returns the provider's configuration, discovering it from the
+// issuer's /.well-known/openid-configuration the first time and once an hour after
+func (c OIDCClient) Provider(ctx context.Context) (*OIDCProvider, error) {
+	oidcProvidersMu.Lock()
+	cached, ok := oidcProviders[c.Issuer]
+	oidcProvidersMu.Unlock()
+	if ok && time.Since(cached.discoveredAt) < oidcDiscoveryTTL {
+		return cached, nil
+	}
+
+	provider := &OIDCProvider{}
+	if err := c.getJSON(ctx, strings.TrimSuffix(c.Issuer, "/")+"/.well-known/openid-configuration", provider); err != nil {
+		return nil, err
+	}
+	// The document must be about the issuer it was fetched from, or anyone able
+	// to serve it could vouch for tokens of another issuer
+	if provider.Issuer != c.Issuer {
+		return nil, oidcError("discovery document is for issuer %q, expected %q", provider.Issuer, c.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, oidcError("discovery document is missing endpoints")
+	}
+	provider.discoveredAt = time.Now()
+
+	oidcProvidersMu.Lock()
+	oidcProviders[c.Issuer] = provider
+	oidcProvidersMu.Unlock()
+	return provider, nil
+}
+
+// PKCEChallenge derives the S256 code challenge sent in place of the verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL is where the browser is sent to log in at the provider
+func (c OIDCClient) AuthCodeURL(provider *OIDCProvider, state, nonce, codeVerifier string) string {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"redirect_uri":          {c.RedirectURL},
+		"scope":                 {strings.Join(c.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {PKCEChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return provider.AuthorizationEndpoint + separator + params.Encode()
+}
+
+// Exchange redeems an authorization code at the token endpoint and returns the raw ID token
+func (c OIDCClient) Exchange(ctx context.Context, provider *OIDCProvider, code, codeVerifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if c.ClientSecret == "" {
+		form.Set("client_id", c.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.ClientSecret != "" {
+		// client_secret_basic, with both halves form-encoded as RFC 6749 asks
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseSize)).Decode(&body); err != nil {
+		return "", oidcError("token endpoint returned %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", oidcError("token endpoint rejected the code: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", oidcError("token endpoint returned no ID token")
+	}
+	return body.IDToken, nil
+}
+
+// VerifyIDToken checks the signature of an ID token against the provider's
+// keys and validates its issuer, audience, lifetime and nonce
+func (c OIDCClient) VerifyIDToken(ctx context.Context, provider *OIDCProvider, rawIDToken, nonce string, now time.Time) (*IDTokenClaims, error) {
+	parser := &jwt.Parser{
+		ValidMethods:         oidcSigningAlgorithms,
+		SkipClaimsValidation: true,
+	}
+
+	claims := &IDTokenClaims{}
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.providerKey(ctx, provider, kid)
+	})
+	if err != nil {
+		return nil, oidcError("invalid ID token: %v", err)
+	}
+
+	skew := int64(config.Auth.JWTClockSkew.Seconds())
+	unixNow := now.Unix()
+	switch {
+	case claims.Issuer != provider.Issuer:
+		return nil, oidcError("ID token issuer %q is not %q", claims.Issuer, provider.Issuer)
+	case !claims.hasAudience(c.ClientID):
+		return nil, oidcError("ID token is not meant for this client")
+	case (len(claims.Audience) > 1 || claims.AuthorizedParty != "") && claims.AuthorizedParty != c.ClientID:
+		return nil, oidcError("ID token was issued to another party")
+	case claims.ExpiresAt == 0 || unixNow > claims.ExpiresAt+skew:
+		return nil, oidcError("ID token has expired")
+	case claims.IssuedAt == 0 || unixNow < claims.IssuedAt-skew:
+		return nil, oidcError("ID token is not valid yet")
+	case claims.Subject == "":
+		return nil, oidcError("ID token has no subject")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, oidcError("ID token nonce does not match")
+	}
+	return claims, nil
+}
+
+// providerKey returns the provider's key named kid, refetching the key set
+// when kid is unknown since the provider may have rotated its keys
+func (c OIDCClient) providerKey(ctx context.Context, provider *OIDCProvider, kid string) (interface{}, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if key := provider.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(provider.keysFetchedAt) < oidcJWKSMinRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []oidcJWK `json:"keys"`
+	}
+	provider.keysFetchedAt = time.Now()
+	if err := c.getJSON(ctx, provider.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	provider.keys = make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			provider.keys[jwk.KeyID] = key
+		}
+	}
+
+	if key := provider.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a key by ID; a token without kid is accepted only when the
+// provider publishes a single key
+func (p *OIDCProvider) lookupKey(kid string) interface{} {
+	if key, ok := p.keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+// oidcJWK is a public key as published in a provider's JWKS
+type oidcJWK struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func (k oidcJWK) publicKey() (interface{}, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return key, nil
+
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// SaveOIDCLogin stores the nonce and PKCE verifier of a login that starts now,
+// so they never leave the server
+func SaveOIDCLogin(state, nonce, codeVerifier string, ttl time.Duration) error {
+	return config.DB.Create(&models.OIDCLogin{
+		StateHash:    HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(ttl),
+	}).Error
+}
+
+// RedeemOIDCLogin returns the nonce and PKCE verifier saved for state and
+// forgets them, so each login can be finished once
+func RedeemOIDCLogin(state string, now time.Time) (nonce, codeVerifier string, err error) {
+	var login models.OIDCLogin
+	result := config.DB.Clauses(clause.Returning{}).
+		Where("state_hash = ?", HashToken(state)).
+		Delete(&login)
+	if result.Error != nil {
+		return "", "", result.Error
+	}
+	if result.RowsAffected == 0 || now.After(login.ExpiresAt) {
+		return "", "", oidcError("unknown or expired login state")
+	}
+	return login.Nonce, login.CodeVerifier, nil
+}
+
+// PruneOIDCLogins drops logins nobody came back to finish
+func PruneOIDCLogins(now time.Time) error {
+	return config.DB.Where("expires_at < ?", now).Delete(&models.OIDCLogin{}).Error
+}
+
+// StartOIDCLoginPruning runs PruneOIDCLogins every interval until the context is cancelled
+func StartOIDCLoginPruning(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, "OIDC logins", PruneOIDCLogins)
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// mockOIDCIssuer serves discovery and JWKS for one RSA key and redeems the
+// code "good-code" when the PKCE verifier matches
+func mockOIDCIssuer(t *testing.T, key *rsa.PrivateKey, challenge string, idToken *string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "blogsite" || secret != "s3cret" || r.FormValue("code") != "good-code" ||
+			PKCEChallenge(r.FormValue("code_verifier")) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": *idToken, "token_type": "Bearer"})
+	})
+	return server
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign ID token: %v", err)
+	}
+	return signed
+}
+
+func TestOIDCClient(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	verifier := "a-verifier-of-sufficient-length-for-pkce-0123456789"
+	var idToken string
+	server := mockOIDCIssuer(t, key, PKCEChallenge(verifier), &idToken)
+
+	client := OIDCClient{Issuer: server.URL, ClientID: "blogsite", ClientSecret: "s3cret", RedirectURL: "http://localhost/cb", Scopes: []string{"openid", "email"}}
+	ctx := context.Background()
+	provider, err := client.Provider(ctx)
+	if err != nil {
+		t.Fatalf("Provider: %v", err)
+	}
+	if provider.TokenEndpoint != server.URL+"/token" {
+		t.Errorf("Unexpected token endpoint %q", provider.TokenEndpoint)
+	}
+
+	wrongIssuer := client
+	wrongIssuer.Issuer = server.URL + "/"
+	if _, err := wrongIssuer.Provider(ctx); err == nil {
+		t.Error("Expected a discovery document for another issuer to be rejected")
+	}
+
+	now := time.Now()
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":            server.URL,
+			"sub":            "subject-1",
+			"aud":            "blogsite",
+			"exp":            now.Add(time.Minute).Unix(),
+			"iat":            now.Unix(),
+			"nonce":          "the-nonce",
+			"email":          "sso@example.com",
+			"email_verified": true,
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	idToken = signIDToken(t, key, "mock-key", claims(nil))
+	if _, err := client.Exchange(ctx, provider, "good-code", "another-verifier"); err == nil {
+		t.Error("Expected the token endpoint to refuse a wrong PKCE verifier")
+	}
+	raw, err := client.Exchange(ctx, provider, "good-code", verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	got, err := client.VerifyIDToken(ctx, provider, raw, "the-nonce", now)
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if got.Subject != "subject-1" || got.Email != "sso@example.com" || !got.EmailVerified {
+		t.Errorf("Unexpected claims %+v", got)
+	}
+
+	accepted := map[string]string{
+		"audience list with azp":  signIDToken(t, key, "mock-key", claims(jwt.MapClaims{"aud": []string{"blogsite", "other"}, "azp": "blogsite"})),
+		"email_verified a string": signIDToken(t, key, "mock-key", claims(jwt.MapClaims{"email_verified": "true"})),
+	}
+	for name, token := range accepted {
+		if _, err := client.VerifyIDToken(ctx, provider, token, "the-nonce", now); err != nil {
+			t.Errorf("%s: expected the ID token to be accepted, got %v", name, err)
+		}
+	}
+
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(nil))
+	hmacToken, _ := hmac.SignedString([]byte("s3cret"))
+	rejected := map[string]string{
+		"wrong nonce":      signIDToken(t, key, "mock-key", claims(jwt.MapClaims{"nonce": "other"})),
+		"wrong audience":   signIDToken(t, key, "mock-key", claims(jwt.MapClaims{"aud": "other"})),
+		"wrong azp":        signIDToken(t, key, "mock-key", claims(jwt.MapClaims{"aud": []string{"blogsite", "other"}, "azp": "other"})),
+		"wrong issuer":     signIDToken(t, key, "mock-key", claims(jwt.MapClaims{"iss": "https://evil.example"})),
+		"expired":          signIDToken(t, key, "mock-key", claims(jwt.MapClaims{"exp": now.Add(-time.Hour).Unix()})),
+		"no subject":       signIDToken(t, key, "mock-key", claims(jwt.MapClaims{"sub": ""})),
+		"unknown key":      signIDToken(t, otherKey, "other-key", claims(nil)),
+		"forged signature": signIDToken(t, otherKey, "mock-key", claims(nil)),
+		"HMAC with secret": hmacToken,
+		"not a JWT at all": "garbage",
+	}
+	for name, token := range rejected {
+		if _, err := client.VerifyIDToken(ctx, provider, token, "the-nonce", now); err == nil {
+			t.Errorf("%s: expected the ID token to be rejected", name)
+		}
+	}
+}
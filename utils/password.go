@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashes are self-describing: bcrypt hashes start with "$2a$<cost>$",
+// argon2id hashes use the PHC string format
+// "$argon2id$v=19$m=<KiB>,t=<passes>,p=<threads>$<salt>$<key>".
+// The algorithm and parameters of new hashes come from config.Auth.
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var (
+	ErrPasswordMismatch     = errors.New("password does not match")
+	ErrUnknownPasswordHash  = errors.New("unknown password hash format")
+	errUnknownHashAlgorithm = errors.New("unknown password hash algorithm")
+)
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func currentArgon2Params() argon2Params {
+	return argon2Params{
+		memory:  uint32(config.Auth.Argon2MemoryKiB),
+		time:    uint32(config.Auth.Argon2Time),
+		threads: uint8(config.Auth.Argon2Threads),
+	}
+}
+
+// CheckPasswordHashConfig reports settings HashPassword cannot work with
+func CheckPasswordHashConfig() error {
+	switch config.Auth.PasswordHashAlgorithm {
+	case "bcrypt":
+		if config.Auth.BcryptCost < bcrypt.MinCost || config.Auth.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return nil
+	case "argon2id":
+		// Out-of-range values would wrap around when converted to argon2's types
+		a := config.Auth
+		if a.Argon2Time < 1 || int64(a.Argon2Time) > math.MaxUint32 {
+			return errors.New("argon2id time must be at least 1")
+		}
+		if a.Argon2Threads < 1 || a.Argon2Threads > 255 {
+			return errors.New("argon2id threads must be between 1 and 255")
+		}
+		// argon2 itself raises a smaller memory to this minimum, which would
+		// make every hash look out of date
+		if a.Argon2MemoryKiB < 8*a.Argon2Threads || int64(a.Argon2MemoryKiB) > math.MaxUint32 {
+			return fmt.Errorf("argon2id memory must be at least %d KiB for %d threads", 8*a.Argon2Threads, a.Argon2Threads)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w %q", errUnknownHashAlgorithm, config.Auth.PasswordHashAlgorithm)
+}
+
+// HashPassword hashes password with the configured algorithm
+func HashPassword(password string) (string, error) {
+	switch config.Auth.PasswordHashAlgorithm {
+	case "bcrypt":
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), config.Auth.BcryptCost)
+		return string(hashed), err
+	case "argon2id":
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		p := currentArgon2Params()
+		key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, argon2KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.time, p.threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+	return "", fmt.Errorf("%w %q", errUnknownHashAlgorithm, config.Auth.PasswordHashAlgorithm)
+}
+
+// CheckPassword compares password with a hash made by HashPassword, whatever
+// settings were current at the time
+func CheckPassword(hash, password string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		p, salt, key, err := parseArgon2Hash(hash)
+		if err != nil {
+			return err
+		}
+		candidate := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return ErrPasswordMismatch
+		}
+		return nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+// PasswordNeedsRehash reports whether hash was made with a different algorithm
+// or parameters than HashPassword would use now
+func PasswordNeedsRehash(hash string) bool {
+	switch config.Auth.PasswordHashAlgorithm {
+	case "bcrypt":
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != config.Auth.BcryptCost
+	case "argon2id":
+		p, _, key, err := parseArgon2Hash(hash)
+		return err != nil || p != currentArgon2Params() || len(key) != argon2KeyLength
+	}
+	return false
+}
+
+func parseArgon2Hash(hash string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrUnknownPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrUnknownPasswordHash
+	}
+	return p, salt, key, nil
+}
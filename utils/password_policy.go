@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"fmt"
+	"log"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcrypt ignores everything after the first 72 bytes
+const bcryptMaxPasswordBytes = 72
+
+// PasswordPolicy is what a new password must satisfy
+type PasswordPolicy struct {
+	MinLength        int
+	MaxLength        int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	// RequireSymbol accepts any character that is not a letter or a digit
+	RequireSymbol bool
+	// MinStrength is the lowest PasswordStrength score accepted, 0 for any
+	MinStrength int
+	// Breached rejects leaked passwords when set
+	Breached *BreachedPasswords
+	// MaxBytes guards against hashes that truncate long passwords, 0 for none
+	MaxBytes int
+}
+
+// breachedPasswords is loaded by InitPasswordPolicy
+var breachedPasswords *BreachedPasswords
+
+// InitPasswordPolicy loads the breached password list named by config.Auth
+func InitPasswordPolicy() error {
+	if config.Auth.PasswordBreachedList == "" {
+		return nil
+	}
+
+	list, err := LoadBreachedPasswords(config.Auth.PasswordBreachedList)
+	if err != nil {
+		return err
+	}
+	log.Printf("Loaded %d breached password hashes", list.Len())
+	breachedPasswords = list
+	return nil
+}
+
+// CurrentPasswordPolicy builds the policy from config.Auth
+func CurrentPasswordPolicy() PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength:        config.Auth.PasswordMinLength,
+		MaxLength:        config.Auth.PasswordMaxLength,
+		RequireUppercase: config.Auth.PasswordRequireUppercase,
+		RequireLowercase: config.Auth.PasswordRequireLowercase,
+		RequireDigit:     config.Auth.PasswordRequireDigit,
+		RequireSymbol:    config.Auth.PasswordRequireSymbol,
+		MinStrength:      config.Auth.PasswordMinStrength,
+		Breached:         breachedPasswords,
+	}
+	if config.Auth.PasswordHashAlgorithm == "bcrypt" {
+		policy.MaxBytes = bcryptMaxPasswordBytes
+	}
+	return policy
+}
+
+// Check returns every rule password breaks, or nil. userInputs are details
+// such as the username and email that make a password easier to guess.
+func (p PasswordPolicy) Check(password string, userInputs ...string) []string {
+	var violations []string
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("Password must be at least %d characters long", p.MinLength))
+	}
+	tooLong := p.MaxLength > 0 && length > p.MaxLength
+	if tooLong {
+		violations = append(violations, fmt.Sprintf("Password must be at most %d characters long", p.MaxLength))
+	} else if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		tooLong = true
+		violations = append(violations, fmt.Sprintf("Password must be at most %d bytes long", p.MaxBytes))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+	if p.RequireUppercase && !upper {
+		violations = append(violations, "Password must contain at least one uppercase letter")
+	}
+	if p.RequireLowercase && !lower {
+		violations = append(violations, "Password must contain at least one lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "Password must contain at least one number")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "Password must contain at least one symbol")
+	}
+
+	// Estimating strength gets slow for long passwords, so skip those that are
+	// rejected anyway
+	if p.MinStrength > 0 && !tooLong && PasswordStrength(password, userInputs...) < p.MinStrength {
+		violations = append(violations, "Password is too easy to guess")
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, "Password has appeared in a data breach")
+	}
+
+	return violations
+}
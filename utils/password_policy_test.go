@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		inputs   []string
+		max      int // highest acceptable score
+		min      int // lowest acceptable score
+	}{
+		{"password", nil, 0, 0},
+		{"P@ssw0rd", nil, 0, 0},
+		{"qwertyuiop", nil, 0, 0},
+		{"aaaaaaaaaaaa", nil, 0, 0},
+		{"abcdefgh", nil, 0, 0},
+		{"Password!23", nil, 1, 0},
+		{"Sunshine2024", nil, 1, 0},
+		{"Jonathan1987!", []string{"jonathan1987!"}, 0, 0},
+		{"StrongPassw0rd!", nil, 4, 2},
+		{"correct horse battery staple", nil, 4, 4},
+		{"x7#Qm-2vLp.9", nil, 4, 4},
+	}
+
+	for _, tc := range tests {
+		score := PasswordStrength(tc.password, tc.inputs...)
+		if score < tc.min || score > tc.max {
+			t.Errorf("PasswordStrength(%q) = %d, want between %d and %d", tc.password, score, tc.min, tc.max)
+		}
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:        8,
+		MaxLength:        64,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		MinStrength:      2,
+		MaxBytes:         72,
+	}
+
+	// Every broken rule is reported at once
+	got := policy.Check("abc")
+	want := []string{
+		"Password must be at least 8 characters long",
+		"Password must contain at least one uppercase letter",
+		"Password must contain at least one number",
+		"Password must contain at least one symbol",
+		"Password is too easy to guess",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check(\"abc\") = %q, want %q", got, want)
+	}
+
+	// Any non-alphanumeric character counts as a symbol
+	for _, password := range []string{"Tulip-Marble-42", "Tulip.Marble.42", "Tulip?Marble?42", "Tulip Marble 42"} {
+		if got := policy.Check(password); got != nil {
+			t.Errorf("Check(%q) = %q, want no violations", password, got)
+		}
+	}
+
+	if got := policy.Check("Caroline-Weber-1990", "carolineweber", "caroline-weber-1990@example.com"); !reflect.DeepEqual(got, []string{"Password is too easy to guess"}) {
+		t.Errorf("Expected a password made of the user's details to be rejected, got %q", got)
+	}
+
+	if got := policy.Check(strings.Repeat("Aa1!", 17)); !reflect.DeepEqual(got, []string{"Password must be at most 64 characters long"}) {
+		t.Errorf("Expected an overlong password to be rejected, got %q", got)
+	}
+	if got := policy.Check(strings.Repeat("Ää1!", 15)); !reflect.DeepEqual(got, []string{"Password must be at most 72 bytes long"}) {
+		t.Errorf("Expected a password over the byte limit to be rejected, got %q", got)
+	}
+
+	relaxed := PasswordPolicy{MinLength: 12}
+	if got := relaxed.Check("just lowercase words"); got != nil {
+		t.Errorf("Expected relaxed policy to accept a passphrase, got %q", got)
+	}
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	dir := t.TempDir()
+
+	// A file of full hashes, as in the downloadable Pwned Passwords list
+	file := filepath.Join(dir, "breached.txt")
+	contents := sha1Hex("Tulip-Marble-42") + ":12\n" + strings.ToLower(sha1Hex("Summer2019!")) + "\n\n"
+	if err := os.WriteFile(file, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory of range files, as the range API returns them
+	ranges := filepath.Join(dir, "ranges")
+	os.Mkdir(ranges, 0700)
+	hash := sha1Hex("Tulip-Marble-42")
+	if err := os.WriteFile(filepath.Join(ranges, hash[:5]+".txt"), []byte(hash[5:]+":12\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(ranges, "README"), []byte("not a range file"), 0600)
+
+	for _, path := range []string{file, ranges} {
+		list, err := LoadBreachedPasswords(path)
+		if err != nil {
+			t.Fatalf("LoadBreachedPasswords(%s): %v", path, err)
+		}
+		if !list.Contains("Tulip-Marble-42") {
+			t.Errorf("Expected %s to contain the breached password", path)
+		}
+		if list.Contains("Tulip-Marble-43") {
+			t.Errorf("Expected %s not to contain an unlisted password", path)
+		}
+
+		policy := PasswordPolicy{Breached: list}
+		if got := policy.Check("Tulip-Marble-42"); !reflect.DeepEqual(got, []string{"Password has appeared in a data breach"}) {
+			t.Errorf("Expected breached password to be rejected, got %q", got)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.txt")
+	os.WriteFile(bad, []byte("not-a-hash\n"), 0600)
+	if _, err := LoadBreachedPasswords(bad); err == nil {
+		t.Error("Expected a malformed list to fail to load")
+	}
+}
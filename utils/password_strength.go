@@ -0,0 +1,409 @@
+package utils
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PasswordStrength scores password from 0 (too guessable) to 4 (very unguessable)
+// the way zxcvbn does: it finds the cheapest way to build the password from
+// common passwords, the user's own details, repeats, sequences, keyboard walks,
+// years and brute force, and buckets the estimated number of guesses.
+//
+// The dictionary is a short list of very common passwords rather than
+// zxcvbn's frequency lists, so scores are a little more generous.
+func PasswordStrength(password string, userInputs ...string) int {
+	guesses := estimateGuesses([]rune(password), rankedDictionary(userInputs))
+	switch {
+	case guesses < 1e3+5:
+		return 0
+	case guesses < 1e6+5:
+		return 1
+	case guesses < 1e8+5:
+		return 2
+	case guesses < 1e10+5:
+		return 3
+	}
+	return 4
+}
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// commonPasswords ranks each word by its position in common_passwords.txt
+var commonPasswords = func() map[string]int {
+	ranks := make(map[string]int)
+	for i, word := range strings.Fields(commonPasswordsFile) {
+		ranks[word] = i + 1
+	}
+	return ranks
+}()
+
+const (
+	bruteforceCardinality = 10
+	minSingleCharGuesses  = 10
+	minMultiCharGuesses   = 50
+	// Each extra match multiplies the guesses by this much at least, so long
+	// passwords made of a few predictable pieces still score well
+	minGuessesBeforeGrowingSequence = 10000
+	keyboardStartingPositions       = 94
+	keyboardAverageDegree           = 4
+	minYearSpace                    = 20
+)
+
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./", "qwertzuiop", "azertyuiop"}
+
+var l33tSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'i', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+// rankedDictionary adds the user's details to the common passwords. They come
+// first since an attacker targeting the account would try them first.
+func rankedDictionary(userInputs []string) map[string]int {
+	if len(userInputs) == 0 {
+		return commonPasswords
+	}
+
+	ranks := make(map[string]int, len(commonPasswords)+len(userInputs))
+	for word, rank := range commonPasswords {
+		ranks[word] = rank + len(userInputs)
+	}
+	for i, input := range userInputs {
+		input = strings.ToLower(input)
+		// An email address is usually guessed by its local part
+		if local, _, ok := strings.Cut(input, "@"); ok {
+			ranks[local] = i + 1
+		}
+		ranks[input] = i + 1
+	}
+	return ranks
+}
+
+type guessMatch struct {
+	start, end int // runes [start, end)
+	guesses    float64
+}
+
+// estimateGuesses runs zxcvbn's search for the sequence of non-overlapping
+// matches covering the password that minimises
+//
+//	l! * product(match guesses) + minGuessesBeforeGrowingSequence^(l-1)
+//
+// for l matches, with brute force filling any gaps
+func estimateGuesses(password []rune, dictionary map[string]int) float64 {
+	n := len(password)
+	if n == 0 {
+		return 1
+	}
+
+	matches := make([][]guessMatch, n+1) // indexed by end
+	for _, m := range findMatches(password, dictionary) {
+		if m.end-m.start < n {
+			m.guesses = math.Max(m.guesses, minimumGuesses(m.end-m.start))
+		}
+		matches[m.end] = append(matches[m.end], m)
+	}
+
+	// best[k][l] is the lowest product covering the first k runes with l
+	// matches, the last of which is not brute force; bruteforce[k][l] is the
+	// same when the last match is brute force. Two brute force matches never
+	// follow each other since one longer match is always cheaper.
+	best := make([][]float64, n+1)
+	bruteforce := make([][]float64, n+1)
+	for k := range best {
+		best[k] = make([]float64, n+2)
+		bruteforce[k] = make([]float64, n+2)
+		for l := range best[k] {
+			best[k][l] = math.Inf(1)
+			bruteforce[k][l] = math.Inf(1)
+		}
+	}
+	best[0][0] = 1
+
+	for k := 1; k <= n; k++ {
+		for _, m := range matches[k] {
+			for l := 1; l <= m.start+1; l++ {
+				prev := math.Min(best[m.start][l-1], bruteforce[m.start][l-1])
+				best[k][l] = math.Min(best[k][l], prev*m.guesses)
+			}
+		}
+		for start := 0; start < k; start++ {
+			guesses := math.Pow(bruteforceCardinality, float64(k-start))
+			if k-start < n {
+				guesses = math.Max(guesses, minimumGuesses(k-start)+1)
+			}
+			for l := 1; l <= start+1; l++ {
+				bruteforce[k][l] = math.Min(bruteforce[k][l], best[start][l-1]*guesses)
+			}
+		}
+	}
+
+	guesses := math.Inf(1)
+	for l := 1; l <= n; l++ {
+		product := math.Min(best[n][l], bruteforce[n][l])
+		if math.IsInf(product, 1) {
+			continue
+		}
+		total := factorial(l)*product + math.Pow(minGuessesBeforeGrowingSequence, float64(l-1))
+		guesses = math.Min(guesses, total)
+	}
+	return guesses
+}
+
+func minimumGuesses(length int) float64 {
+	if length == 1 {
+		return minSingleCharGuesses
+	}
+	return minMultiCharGuesses
+}
+
+func factorial(n int) float64 {
+	f := 1.0
+	for i := 2; i <= n; i++ {
+		f *= float64(i)
+	}
+	return f
+}
+
+func findMatches(password []rune, dictionary map[string]int) []guessMatch {
+	var matches []guessMatch
+	matches = append(matches, dictionaryMatches(password, dictionary)...)
+	matches = append(matches, repeatMatches(password, dictionary)...)
+	matches = append(matches, sequenceMatches(password)...)
+	matches = append(matches, keyboardMatches(password)...)
+	matches = append(matches, yearMatches(password)...)
+	return matches
+}
+
+// dictionaryMatches finds dictionary words, also when capitalised or written
+// with l33t substitutions such as "p@ssw0rd"
+func dictionaryMatches(password []rune, dictionary map[string]int) []guessMatch {
+	var matches []guessMatch
+	for i := range password {
+		for j := i + 3; j <= len(password); j++ {
+			token := password[i:j]
+			lower := []rune(strings.ToLower(string(token)))
+			if rank, ok := dictionary[string(lower)]; ok {
+				matches = append(matches, guessMatch{i, j, float64(rank) * uppercaseVariations(token)})
+			}
+
+			unsubbed, subbed := unl33t(lower)
+			if subbed == 0 {
+				continue
+			}
+			if rank, ok := dictionary[string(unsubbed)]; ok {
+				guesses := float64(rank) * uppercaseVariations(token) * l33tVariations(lower, unsubbed)
+				matches = append(matches, guessMatch{i, j, guesses})
+			}
+		}
+	}
+	return matches
+}
+
+func unl33t(token []rune) ([]rune, int) {
+	unsubbed := make([]rune, len(token))
+	subbed := 0
+	for i, r := range token {
+		if plain, ok := l33tSubstitutions[r]; ok {
+			unsubbed[i] = plain
+			subbed++
+		} else {
+			unsubbed[i] = r
+		}
+	}
+	return unsubbed, subbed
+}
+
+// l33tVariations counts the ways of substituting each letter that token
+// substitutes at least once
+func l33tVariations(token, unsubbed []rune) float64 {
+	subbed, plain := make(map[rune]int), make(map[rune]int)
+	for i, r := range token {
+		if r != unsubbed[i] {
+			subbed[unsubbed[i]]++
+		} else {
+			plain[r]++
+		}
+	}
+
+	result := 1.0
+	for letter, count := range subbed {
+		result *= variations(count, plain[letter])
+	}
+	return result
+}
+
+// uppercaseVariations counts the capitalisations an attacker tries before
+// reaching token's. Capitalising only the first or every letter is cheap.
+func uppercaseVariations(token []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range token {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 1
+	case lower == 0, upper == 1 && unicode.IsUpper(token[0]):
+		return 2
+	}
+	return variations(upper, lower)
+}
+
+// variations is the number of ways to pick up to min(a, b) of a+b positions
+func variations(a, b int) float64 {
+	if a == 0 || b == 0 {
+		return 2
+	}
+	sum := 0.0
+	for i := 1; i <= a && i <= b; i++ {
+		sum += binomial(a+b, i)
+	}
+	return sum
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+// repeatMatches finds a character or block repeated back to back, such as
+// "aaaa" or "abcabc". Only the shortest repeating block at each position is
+// considered, which keeps the recursion into the block shallow.
+func repeatMatches(password []rune, dictionary map[string]int) []guessMatch {
+	var matches []guessMatch
+	for i := range password {
+		for size := 1; i+2*size <= len(password); size++ {
+			block := string(password[i : i+size])
+			count := 1
+			for j := i + size; j+size <= len(password) && string(password[j:j+size]) == block; j += size {
+				count++
+			}
+			if count < 2 || (size == 1 && count < 3) {
+				continue
+			}
+			base := estimateGuesses(password[i:i+size], dictionary)
+			matches = append(matches, guessMatch{i, i + size*count, base * float64(count)})
+			break
+		}
+	}
+	return matches
+}
+
+// sequenceMatches finds runs of at least three characters from the same class
+// with a constant step, such as "abc", "9753" or "ZYX"
+func sequenceMatches(password []rune) []guessMatch {
+	var matches []guessMatch
+	start := 0
+	for start < len(password)-2 {
+		delta := password[start+1] - password[start]
+		end := start + 1
+		for end < len(password) && password[end]-password[end-1] == delta &&
+			sameCharClass(password[start], password[end]) {
+			end++
+		}
+		if end-start >= 3 && delta != 0 && delta >= -5 && delta <= 5 {
+			matches = append(matches, guessMatch{start, end, sequenceGuesses(password[start:end], delta)})
+			start = end - 1
+			continue
+		}
+		start++
+	}
+	return matches
+}
+
+func sameCharClass(a, b rune) bool {
+	switch {
+	case unicode.IsDigit(a):
+		return unicode.IsDigit(b)
+	case unicode.IsLower(a):
+		return unicode.IsLower(b)
+	case unicode.IsUpper(a):
+		return unicode.IsUpper(b)
+	}
+	return false
+}
+
+func sequenceGuesses(token []rune, delta rune) float64 {
+	var base float64
+	switch first := token[0]; {
+	case strings.ContainsRune("aAzZ019", first):
+		base = 4
+	case unicode.IsDigit(first):
+		base = 10
+	default:
+		base = 26
+	}
+	if delta < 0 {
+		base *= 2
+	}
+	return base * float64(len(token))
+}
+
+// keyboardMatches finds walks of at least four keys along a keyboard row,
+// forwards or backwards
+func keyboardMatches(password []rune) []guessMatch {
+	runes := make([]rune, len(password))
+	for i, r := range password {
+		runes[i] = unicode.ToLower(r)
+	}
+
+	var matches []guessMatch
+	for i := range runes {
+		for j := i + 4; j <= len(runes); j++ {
+			token := string(runes[i:j])
+			if !onKeyboardRow(token) {
+				break
+			}
+			guesses := float64(j-i-1) * keyboardStartingPositions * keyboardAverageDegree
+			matches = append(matches, guessMatch{i, j, guesses * uppercaseVariations(password[i:j])})
+		}
+	}
+	return matches
+}
+
+func onKeyboardRow(token string) bool {
+	reversed := []rune(token)
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	for _, row := range keyboardRows {
+		if strings.Contains(row, token) || strings.Contains(row, string(reversed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// yearMatches finds recent years, which are guessed by their distance from now
+func yearMatches(password []rune) []guessMatch {
+	var matches []guessMatch
+	now := time.Now().Year()
+	for i := 0; i+4 <= len(password); i++ {
+		year := 0
+		for _, r := range password[i : i+4] {
+			if r < '0' || r > '9' {
+				year = -1
+				break
+			}
+			year = year*10 + int(r-'0')
+		}
+		if year < 1900 || year > 2099 {
+			continue
+		}
+		space := math.Max(math.Abs(float64(year-now)), minYearSpace)
+		matches = append(matches, guessMatch{i, i + 4, space})
+	}
+	return matches
+}
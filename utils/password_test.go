@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHashing(t *testing.T) {
+	previous := config.Auth
+	defer func() { config.Auth = previous }()
+	config.Auth.BcryptCost = bcrypt.MinCost
+	config.Auth.Argon2Time = 1
+	config.Auth.Argon2MemoryKiB = 1024
+	config.Auth.Argon2Threads = 1
+
+	for _, algorithm := range []string{"bcrypt", "argon2id"} {
+		t.Run(algorithm, func(t *testing.T) {
+			config.Auth.PasswordHashAlgorithm = algorithm
+
+			hash, err := HashPassword("Password!23")
+			if err != nil {
+				t.Fatalf("Failed to hash password: %v", err)
+			}
+			if err := CheckPassword(hash, "Password!23"); err != nil {
+				t.Errorf("Expected password to match, got %v", err)
+			}
+			if err := CheckPassword(hash, "password!23"); !errors.Is(err, ErrPasswordMismatch) {
+				t.Errorf("Expected ErrPasswordMismatch, got %v", err)
+			}
+			if PasswordNeedsRehash(hash) {
+				t.Errorf("Fresh hash should not need rehashing")
+			}
+		})
+	}
+
+	config.Auth.PasswordHashAlgorithm = "bcrypt"
+	bcryptHash, _ := HashPassword("Password!23")
+
+	config.Auth.BcryptCost = bcrypt.MinCost + 1
+	if !PasswordNeedsRehash(bcryptHash) {
+		t.Errorf("Expected bcrypt hash with an old cost to need rehashing")
+	}
+
+	config.Auth.PasswordHashAlgorithm = "argon2id"
+	if !PasswordNeedsRehash(bcryptHash) {
+		t.Errorf("Expected bcrypt hash to need rehashing once argon2id is configured")
+	}
+	// Old hashes keep verifying after the switch
+	if err := CheckPassword(bcryptHash, "Password!23"); err != nil {
+		t.Errorf("Expected bcrypt hash to still verify, got %v", err)
+	}
+
+	argonHash, _ := HashPassword("Password!23")
+	if !strings.HasPrefix(argonHash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("Unexpected argon2id hash format %q", argonHash)
+	}
+	config.Auth.Argon2Time = 2
+	if !PasswordNeedsRehash(argonHash) {
+		t.Errorf("Expected argon2id hash with old parameters to need rehashing")
+	}
+
+	if err := CheckPassword("$argon2id$v=19$garbage", "Password!23"); !errors.Is(err, ErrUnknownPasswordHash) {
+		t.Errorf("Expected ErrUnknownPasswordHash, got %v", err)
+	}
+}
+
+func TestCheckPasswordHashConfig(t *testing.T) {
+	previous := config.Auth
+	defer func() { config.Auth = previous }()
+	config.Auth.PasswordHashAlgorithm = "argon2id"
+
+	tests := []struct {
+		time, memory, threads int
+		valid                 bool
+	}{
+		{time: 1, memory: 64 * 1024, threads: 4, valid: true},
+		{time: 1, memory: 8, threads: 1, valid: true},
+		{time: 0, memory: 64 * 1024, threads: 4},
+		{time: -1, memory: 64 * 1024, threads: 4},
+		{time: 1, memory: 64 * 1024, threads: 0},
+		{time: 1, memory: 64 * 1024, threads: 256},
+		{time: 1, memory: 31, threads: 4},
+		{time: 1, memory: -1, threads: 4},
+	}
+	for _, tc := range tests {
+		config.Auth.Argon2Time, config.Auth.Argon2MemoryKiB, config.Auth.Argon2Threads = tc.time, tc.memory, tc.threads
+		if err := CheckPasswordHashConfig(); (err == nil) != tc.valid {
+			t.Errorf("t=%d m=%d p=%d: expected valid=%v, got %v", tc.time, tc.memory, tc.threads, tc.valid, err)
+		}
+	}
+}
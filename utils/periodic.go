@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// runPeriodically calls fn every interval in the background until ctx is
+// cancelled, logging failures under name
+func runPeriodically(ctx context.Context, interval time.Duration, name string, fn func(now time.Time) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := fn(now); err != nil {
+					log.Printf("Error pruning %s: %v", name, err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"errors"
+	"strings"
+	"time"
+)
+
+// PersonalAccessTokenPrefix marks personal access tokens, so they are easy to
+// tell apart from JWTs and to find with secret scanners
+const PersonalAccessTokenPrefix = "bsp_"
+
+// lastUsedResolution bounds how often using a token writes to the database
+const lastUsedResolution = time.Minute
+
+var ErrPersonalAccessTokenInvalid = errors.New("invalid personal access token")
+
+// GeneratePersonalAccessToken returns a new token and the prefix shown to its owner
+func GeneratePersonalAccessToken() (string, string, error) {
+	secret, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	token := PersonalAccessTokenPrefix + secret
+	return token, token[:len(PersonalAccessTokenPrefix)+8], nil
+}
+
+// IsPersonalAccessToken reports whether a bearer token looks like a personal access token
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// AuthenticatePersonalAccessToken looks up an unexpired token and its owner
+// and records that it was used
+func AuthenticatePersonalAccessToken(token string, now time.Time) (*models.PersonalAccessToken, *models.User, error) {
+	var pat models.PersonalAccessToken
+	if err := config.DB.Where("token_hash = ?", HashToken(token)).First(&pat).Error; err != nil {
+		return nil, nil, ErrPersonalAccessTokenInvalid
+	}
+	if !now.Before(pat.ExpiresAt) {
+		return nil, nil, ErrPersonalAccessTokenInvalid
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, pat.UserID).Error; err != nil {
+		return nil, nil, ErrPersonalAccessTokenInvalid
+	}
+
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) >= lastUsedResolution {
+		if err := config.DB.Model(&pat).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, nil, err
+		}
+		pat.LastUsedAt = &now
+	}
+	return &pat, &user, nil
+}
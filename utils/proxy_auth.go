@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"errors"
+	"net"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+const maxProxyUsernameLength = 255
+
+var (
+	// ErrProxyUserInvalid is returned for header values that cannot be a username or email
+	ErrProxyUserInvalid = errors.New("invalid user from proxy")
+	// ErrProxyUserUnknown is returned for users Blogsite may not create itself
+	ErrProxyUserUnknown = errors.New("unknown user from proxy")
+	// ErrProxyUserConflict is returned when the username or email of a new user
+	// is already taken by an account the proxy did not create
+	ErrProxyUserConflict = errors.New("user from proxy conflicts with an existing account")
+)
+
+// IsTrustedProxy reports whether r comes straight from one of
+// config.Auth.ProxyAuthTrustedProxies
+func IsTrustedProxy(r *http.Request) bool {
+	return isTrustedProxyIP(net.ParseIP(peerIP(r)))
+}
+
+func isTrustedProxyIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range config.Auth.ProxyAuthTrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyAuthHeaders returns the user a trusted reverse proxy authenticated the
+// request as. ok is false when proxy authentication is off, the request did
+// not come from a trusted proxy, or the proxy named no user.
+func ProxyAuthHeaders(r *http.Request) (username, email string, ok bool) {
+	if !config.Auth.ProxyAuthEnabled() || !IsTrustedProxy(r) {
+		return "", "", false
+	}
+	username = strings.TrimSpace(r.Header.Get(config.Auth.ProxyAuthUserHeader))
+	email = strings.ToLower(strings.TrimSpace(r.Header.Get(config.Auth.ProxyAuthEmailHeader)))
+	return username, email, username != ""
+}
+
+// ProxyUser looks up the user named by a trusted proxy, creating them if
+// config.Auth.ProxyAuthAutoProvision allows. New users need an email address,
+// which the proxy vouches for.
+func ProxyUser(username, email string) (models.User, error) {
+	if len(username) > maxProxyUsernameLength || strings.IndexFunc(username, unicode.IsControl) >= 0 {
+		return models.User{}, ErrProxyUserInvalid
+	}
+
+	user, err := findProxyUser(username)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	// Accounts of other kinds are never handed to the proxy. Deleted accounts
+	// keep their username and email until they are purged.
+	var taken int64
+	if err := config.DB.Unscoped().Model(&models.User{}).
+		Where("LOWER(username) = LOWER(?) OR LOWER(email) = ?", username, email).
+		Count(&taken).Error; err != nil {
+		return models.User{}, err
+	}
+	if taken > 0 {
+		return models.User{}, ErrProxyUserConflict
+	}
+	if !config.Auth.ProxyAuthAutoProvision {
+		return models.User{}, ErrProxyUserUnknown
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return models.User{}, ErrProxyUserInvalid
+	}
+
+	now := time.Now()
+	user = models.User{
+		Username:        username,
+		Email:           email,
+		AuthSource:      models.AuthSourceProxy,
+		ExternalID:      username,
+		EmailVerifiedAt: &now,
+	}
+	if config.Auth.RegistrationMode == config.RegistrationApproval {
+		user.Status = models.StatusPending
+	}
+	if err := config.DB.Create(&user).Error; err != nil {
+		// Another request for the same new user may have created it first
+		if existing, findErr := findProxyUser(username); findErr == nil {
+			return existing, nil
+		}
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// findProxyUser looks only among the accounts the proxy created, by the name
+// it gave them, ignoring case. Accounts from before ExternalID was recorded
+// are matched by their username, which proxy users cannot change.
+func findProxyUser(username string) (models.User, error) {
+	var user models.User
+	err := config.DB.Where("auth_source = ?", models.AuthSourceProxy).
+		Where("LOWER(external_id) = LOWER(?) OR (external_id = '' AND LOWER(username) = LOWER(?))", username, username).
+		First(&user).Error
+	return user, err
+}
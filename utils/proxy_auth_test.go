@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyAuthHeaders(t *testing.T) {
+	previous := config.Auth
+	defer func() { config.Auth = previous }()
+	config.Auth.ProxyAuthUserHeader = "X-Forwarded-User"
+	config.Auth.ProxyAuthEmailHeader = "X-Forwarded-Email"
+
+	request := func(remoteAddr string) (string, string, bool) {
+		req := httptest.NewRequest("GET", "/api/feed", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-User", " jdoe ")
+		req.Header.Set("X-Forwarded-Email", "JDoe@Example.com")
+		return ProxyAuthHeaders(req)
+	}
+
+	config.Auth.ProxyAuthTrustedProxies = nil
+	if _, _, ok := request("10.0.0.7:41000"); ok {
+		t.Error("Expected the headers to be ignored while proxy authentication is off")
+	}
+
+	_, v4, _ := net.ParseCIDR("10.0.0.0/24")
+	_, v6, _ := net.ParseCIDR("fd00::/64")
+	config.Auth.ProxyAuthTrustedProxies = []*net.IPNet{v4, v6}
+
+	tests := []struct {
+		remoteAddr string
+		trusted    bool
+	}{
+		{"10.0.0.7:41000", true},
+		{"[fd00::7]:41000", true},
+		{"10.0.1.7:41000", false},
+		{"[fd01::7]:41000", false},
+		{"not-an-address", false},
+	}
+	for _, tc := range tests {
+		username, email, ok := request(tc.remoteAddr)
+		if ok != tc.trusted {
+			t.Errorf("%s: expected trusted %v, got %v", tc.remoteAddr, tc.trusted, ok)
+			continue
+		}
+		if ok && (username != "jdoe" || email != "jdoe@example.com") {
+			t.Errorf("%s: unexpected user %q <%s>", tc.remoteAddr, username, email)
+		}
+	}
+}
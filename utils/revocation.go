@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type cachedVersion struct {
+	version   uint
+	checkedAt time.Time
+}
+
+// RevocationStore tracks revoked access tokens and per-user token versions.
+// Postgres is the source of truth; lookups are cached in-process so that most
+// requests do not hit the database. Revocations made by this process are seen
+// immediately, those made by other instances within config.Auth.RevocationCacheTTL.
+type RevocationStore struct {
+	mu       sync.RWMutex
+	revoked  map[string]time.Time // jti -> token expiry
+	checked  map[string]time.Time // jti -> last time the database said "not revoked"
+	versions map[uint]cachedVersion
+}
+
+// Revocations is the store shared by the auth middleware and handlers
+var Revocations = NewRevocationStore()
+
+func NewRevocationStore() *RevocationStore {
+	return &RevocationStore{
+		revoked:  make(map[string]time.Time),
+		checked:  make(map[string]time.Time),
+		versions: make(map[uint]cachedVersion),
+	}
+}
+
+// Revoke invalidates a single access token until it expires
+func (s *RevocationStore) Revoke(jti string, userID uint, expiresAt time.Time) error {
+	record := models.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt}
+	if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.revoked[jti] = expiresAt
+	delete(s.checked, jti)
+	s.mu.Unlock()
+	return nil
+}
+
+// Consume marks a single-use token as spent. It reports false if the token
+// had already been consumed or revoked, even by a concurrent request.
+func (s *RevocationStore) Consume(jti string, userID uint, expiresAt time.Time) (bool, error) {
+	record := models.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt}
+	result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	s.mu.Lock()
+	s.revoked[jti] = expiresAt
+	delete(s.checked, jti)
+	s.mu.Unlock()
+	return result.RowsAffected == 1, nil
+}
+
+// IsRevoked reports whether the token with the given jti has been revoked
+func (s *RevocationStore) IsRevoked(jti string) (bool, error) {
+	now := time.Now()
+
+	s.mu.RLock()
+	_, revoked := s.revoked[jti]
+	checkedAt, checked := s.checked[jti]
+	s.mu.RUnlock()
+
+	if revoked {
+		return true, nil
+	}
+	if checked && now.Sub(checkedAt) < config.Auth.RevocationCacheTTL {
+		return false, nil
+	}
+
+	var record models.RevokedToken
+	err := config.DB.Where("jti = ?", jti).First(&record).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.revoked[jti] = record.ExpiresAt
+		delete(s.checked, jti)
+		return true, nil
+	}
+	s.checked[jti] = now
+	return false, nil
+}
+
+// TokenVersion returns the user's current token version
+func (s *RevocationStore) TokenVersion(userID uint) (uint, error) {
+	s.mu.RLock()
+	cached, ok := s.versions[userID]
+	s.mu.RUnlock()
+	if ok && time.Since(cached.checkedAt) < config.Auth.RevocationCacheTTL {
+		return cached.version, nil
+	}
+
+	var user models.User
+	if err := config.DB.Select("id", "token_version").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	s.versions[userID] = cachedVersion{version: user.TokenVersion, checkedAt: time.Now()}
+	s.mu.Unlock()
+	return user.TokenVersion, nil
+}
+
+// BumpTokenVersion invalidates every access token previously issued to the
+// user. Inside Transaction, the cached version is dropped once tx commits;
+// dropping it earlier would let a concurrent request cache the old version.
+func (s *RevocationStore) BumpTokenVersion(tx *gorm.DB, userID uint) error {
+	err := tx.Model(&models.User{}).Where("id = ?", userID).
+		Update("token_version", gorm.Expr("token_version + 1")).Error
+	if err != nil {
+		return err
+	}
+
+	AfterCommit(tx, func() {
+		s.mu.Lock()
+		delete(s.versions, userID)
+		s.mu.Unlock()
+	})
+	return nil
+}
+
+// Prune drops revocations for tokens that have expired anyway
+func (s *RevocationStore) Prune(now time.Time) error {
+	if err := config.DB.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for jti, expiresAt := range s.revoked {
+		if now.After(expiresAt) {
+			delete(s.revoked, jti)
+		}
+	}
+	for jti, checkedAt := range s.checked {
+		if now.Sub(checkedAt) >= config.Auth.RevocationCacheTTL {
+			delete(s.checked, jti)
+		}
+	}
+	for userID, cached := range s.versions {
+		if now.Sub(cached.checkedAt) >= config.Auth.RevocationCacheTTL {
+			delete(s.versions, userID)
+		}
+	}
+	return nil
+}
+
+// StartPruning runs Prune every interval until the context is cancelled
+func (s *RevocationStore) StartPruning(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, "revoked tokens", s.Prune)
+}
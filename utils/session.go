@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const maxUserAgentLength = 512
+
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+type cachedSession struct {
+	active    bool
+	checkedAt time.Time
+}
+
+// SessionStore records logins and answers whether a session is still active.
+// Like RevocationStore, lookups are cached for config.Auth.RevocationCacheTTL,
+// which also bounds how often a session's last-seen time is written.
+type SessionStore struct {
+	mu     sync.RWMutex
+	cached map[string]cachedSession
+}
+
+// Sessions is the store shared by the auth middleware and handlers
+var Sessions = NewSessionStore()
+
+func NewSessionStore() *SessionStore {
+	return &SessionStore{cached: make(map[string]cachedSession)}
+}
+
+func newSession(id string, userID uint, userAgent, ip string, now time.Time) *models.Session {
+	return &models.Session{
+		ID:         id,
+		UserID:     userID,
+		Device:     DescribeUserAgent(userAgent),
+		UserAgent:  truncate(userAgent, maxUserAgentLength),
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+}
+
+// Start records a new session for user and returns its ID
+func (s *SessionStore) Start(tx *gorm.DB, userID uint, userAgent, ip string) (string, error) {
+	id, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Create(newSession(id, userID, userAgent, ip, time.Now())).Error; err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Resume marks a session as seen when its refresh token is rotated. Refresh
+// token families issued before sessions were recorded get a session on the way.
+func (s *SessionStore) Resume(tx *gorm.DB, id string, userID uint, userAgent, ip string) error {
+	now := time.Now()
+	var session models.Session
+	err := tx.Where("id = ?", id).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.Create(newSession(id, userID, userAgent, ip, now)).Error
+	}
+	if err != nil {
+		return err
+	}
+	if session.RevokedAt != nil || session.UserID != userID {
+		return ErrSessionRevoked
+	}
+	return tx.Model(&session).Updates(map[string]interface{}{"last_seen_at": now, "ip": ip}).Error
+}
+
+// Touch reports whether the session is active and, when the cached answer is
+// stale, refreshes it and the session's last-seen time in one query
+func (s *SessionStore) Touch(id string, now time.Time) (bool, error) {
+	s.mu.RLock()
+	cached, ok := s.cached[id]
+	s.mu.RUnlock()
+	if ok && (!cached.active || now.Sub(cached.checkedAt) < config.Auth.RevocationCacheTTL) {
+		return cached.active, nil
+	}
+
+	result := config.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("last_seen_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	active := result.RowsAffected == 1
+	s.mu.Lock()
+	s.cached[id] = cachedSession{active: active, checkedAt: now}
+	s.mu.Unlock()
+	return active, nil
+}
+
+// Revoke ends sessions of userID along with their refresh tokens. With no ids,
+// every session of the user is revoked. Inside Transaction, the sessions are
+// cached as ended once tx commits.
+func (s *SessionStore) Revoke(tx *gorm.DB, userID uint, ids ...string) (int64, error) {
+	now := time.Now()
+
+	sessions := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	tokens := tx.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if len(ids) > 0 {
+		sessions = sessions.Where("id IN ?", ids)
+		tokens = tokens.Where("family_id IN ?", ids)
+	}
+
+	result := sessions.Update("revoked_at", now)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if err := tokens.Update("revoked_at", now).Error; err != nil {
+		return 0, err
+	}
+
+	AfterCommit(tx, func() {
+		s.mu.Lock()
+		for _, id := range ids {
+			s.cached[id] = cachedSession{active: false, checkedAt: now}
+		}
+		s.mu.Unlock()
+	})
+	return result.RowsAffected, nil
+}
+
+// Prune forgets cached answers and deletes sessions that ended a refresh
+// token lifetime ago
+func (s *SessionStore) Prune(now time.Time) error {
+	cutoff := now.Add(-config.Auth.RefreshTokenTTL)
+	if err := config.DB.
+		Where("last_seen_at < ? OR revoked_at < ?", cutoff, cutoff).
+		Delete(&models.Session{}).Error; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, cached := range s.cached {
+		if now.Sub(cached.checkedAt) >= config.Auth.RevocationCacheTTL {
+			delete(s.cached, id)
+		}
+	}
+	return nil
+}
+
+// StartPruning runs Prune every interval until the context is cancelled
+func (s *SessionStore) StartPruning(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, "sessions", s.Prune)
+}
+
+// The first matching token names the browser and the operating system
+var (
+	userAgentBrowsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"PostmanRuntime/", "Postman"},
+		{"Go-http-client/", "Go"},
+		{"python-requests/", "Python"},
+	}
+	userAgentSystems = []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// DescribeUserAgent turns a User-Agent header into a short label such as
+// "Firefox on Windows", good enough for users to recognise their devices
+func DescribeUserAgent(userAgent string) string {
+	browser, system := "", ""
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, sys := range userAgentSystems {
+		if strings.Contains(userAgent, sys.token) {
+			system = sys.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "Unknown device"
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
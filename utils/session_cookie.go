@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// refreshCookiePath keeps the refresh token from being sent anywhere but the
+// endpoint that redeems it
+const refreshCookiePath = "/api/token/refresh"
+
+func cookieSameSite() http.SameSite {
+	switch strings.ToLower(config.Auth.CookieSameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
+
+func sessionCookie(name, value, path string, ttl time.Duration, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   config.Auth.CookieDomain,
+		Secure:   config.Auth.CookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: cookieSameSite(),
+	}
+	if ttl > 0 {
+		cookie.MaxAge = int(ttl.Seconds())
+		cookie.Expires = time.Now().Add(ttl)
+	} else {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// WantsSessionCookies reports whether the client asked for its tokens as
+// cookies, which only browsers should do
+func WantsSessionCookies(r *http.Request) bool {
+	return config.Auth.SessionCookies && strings.EqualFold(r.Header.Get(config.Auth.SessionModeHeader), "cookie")
+}
+
+// SetSessionCookies hands a token pair to the browser. The CSRF cookie is the
+// only one scripts can read, so they can repeat it in config.Auth.CSRFHeader.
+func SetSessionCookies(w http.ResponseWriter, accessToken, refreshToken, csrfToken string) {
+	http.SetCookie(w, sessionCookie(config.Auth.SessionCookieName, accessToken, "/", config.Auth.AccessTokenTTL, true))
+	http.SetCookie(w, sessionCookie(config.Auth.RefreshCookieName, refreshToken, refreshCookiePath, config.Auth.RefreshTokenTTL, true))
+	http.SetCookie(w, sessionCookie(config.Auth.CSRFCookieName, csrfToken, "/", config.Auth.RefreshTokenTTL, false))
+}
+
+// ClearSessionCookies tells the browser to drop the cookies set by SetSessionCookies
+func ClearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, sessionCookie(config.Auth.SessionCookieName, "", "/", 0, true))
+	http.SetCookie(w, sessionCookie(config.Auth.RefreshCookieName, "", refreshCookiePath, 0, true))
+	http.SetCookie(w, sessionCookie(config.Auth.CSRFCookieName, "", "/", 0, false))
+}
+
+func cookieValue(r *http.Request, name string) (string, bool) {
+	if !config.Auth.SessionCookies {
+		return "", false
+	}
+	cookie, err := r.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// SessionCookie returns the access token sent as a cookie, if cookie sessions are on
+func SessionCookie(r *http.Request) (string, bool) {
+	return cookieValue(r, config.Auth.SessionCookieName)
+}
+
+// RefreshCookie returns the refresh token sent as a cookie, if cookie sessions are on
+func RefreshCookie(r *http.Request) (string, bool) {
+	return cookieValue(r, config.Auth.RefreshCookieName)
+}
+
+// CSRFCookie returns the CSRF token the browser holds, if cookie sessions are on
+func CSRFCookie(r *http.Request) (string, bool) {
+	return cookieValue(r, config.Auth.CSRFCookieName)
+}
+
+// IsSafeMethod reports whether method cannot change state, and so needs no CSRF check
+func IsSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// ValidCSRFToken reports whether r repeats its CSRF cookie in
+// config.Auth.CSRFHeader. Other sites can make the browser send the cookie
+// but cannot read it to set the header.
+func ValidCSRFToken(r *http.Request) bool {
+	cookie, ok := CSRFCookie(r)
+	header := r.Header.Get(config.Auth.CSRFHeader)
+	return ok && header != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidCSRFToken(t *testing.T) {
+	previous := config.Auth
+	defer func() { config.Auth = previous }()
+	config.Auth.SessionCookies = true
+	config.Auth.CSRFCookieName = "blogsite_csrf"
+	config.Auth.CSRFHeader = "X-CSRF-Token"
+
+	tests := []struct {
+		name   string
+		cookie string
+		header string
+		valid  bool
+	}{
+		{name: "Matching", cookie: "abc123", header: "abc123", valid: true},
+		{name: "Different", cookie: "abc123", header: "abc124", valid: false},
+		{name: "No header", cookie: "abc123", header: "", valid: false},
+		{name: "No cookie", cookie: "", header: "abc123", valid: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/user/blog", nil)
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "blogsite_csrf", Value: tc.cookie})
+			}
+			if tc.header != "" {
+				req.Header.Set("X-CSRF-Token", tc.header)
+			}
+			if got := ValidCSRFToken(req); got != tc.valid {
+				t.Errorf("Expected %v, got %v", tc.valid, got)
+			}
+		})
+	}
+
+	config.Auth.SessionCookies = false
+	req := httptest.NewRequest("POST", "/api/user/blog", nil)
+	req.AddCookie(&http.Cookie{Name: "blogsite_csrf", Value: "abc123"})
+	req.Header.Set("X-CSRF-Token", "abc123")
+	if ValidCSRFToken(req) {
+		t.Error("Expected cookies to be ignored while cookie sessions are off")
+	}
+}
+
+func TestWantsSessionCookies(t *testing.T) {
+	previous := config.Auth
+	defer func() { config.Auth = previous }()
+	config.Auth.SessionModeHeader = "X-Session-Mode"
+
+	tests := []struct {
+		enabled bool
+		header  string
+		wants   bool
+	}{
+		{enabled: true, header: "cookie", wants: true},
+		{enabled: true, header: "Cookie", wants: true},
+		{enabled: true, header: "", wants: false},
+		{enabled: true, header: "token", wants: false},
+		{enabled: false, header: "cookie", wants: false},
+	}
+	for _, tc := range tests {
+		config.Auth.SessionCookies = tc.enabled
+		req := httptest.NewRequest("POST", "/api/login", nil)
+		if tc.header != "" {
+			req.Header.Set("X-Session-Mode", tc.header)
+		}
+		if got := WantsSessionCookies(req); got != tc.wants {
+			t.Errorf("enabled=%v header=%q: expected %v, got %v", tc.enabled, tc.header, tc.wants, got)
+		}
+	}
+}
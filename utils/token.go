@@ -1,36 +1,148 @@
 package utils
 
 import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
-var jwtKey = []byte("golangapplication")
+// Errors returned by ParseJWTClaims; the auth middleware maps each to its own 401 reason
+var (
+	ErrTokenMalformed   = errors.New("token is malformed")
+	ErrTokenSignature   = errors.New("token signature is invalid")
+	ErrTokenExpired     = errors.New("token has expired")
+	ErrTokenNotYetValid = errors.New("token is not valid yet")
+	ErrTokenIssuer      = errors.New("token issuer is invalid")
+	ErrTokenAudience    = errors.New("token audience is invalid")
+	ErrTokenClaims      = errors.New("token claims are invalid")
+)
+
+// Claims are the claims carried by a Blogsite access token
+type Claims struct {
+	UserID       string `json:"userID"` // Stores userID as a string representation of an integer
+	TokenVersion uint   `json:"ver"`
+	Role         string `json:"role"`
+	// SessionID names the login the token was issued for, see models.Session
+	SessionID string `json:"sid,omitempty"`
+	jwt.StandardClaims
+}
+
+// Valid is a no-op so that jwt-go defers to validateClaims, which knows about clock skew
+func (c *Claims) Valid() error {
+	return nil
+}
+
+// GenerateJWT for a given user, carrying a unique jti and the user's token version
+func GenerateJWT(user models.User) (string, error) {
+	return GenerateSessionJWT(user, "")
+}
+
+// GenerateSessionJWT issues an access token bound to a login session, which
+// stops working as soon as the session is revoked
+func GenerateSessionJWT(user models.User, sessionID string) (string, error) {
+	jti, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		UserID:       strconv.FormatUint(uint64(user.ID), 10),
+		TokenVersion: user.TokenVersion,
+		Role:         string(user.Role),
+		SessionID:    sessionID,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Issuer:    config.Auth.JWTIssuer,
+			Audience:  config.Auth.JWTAudience,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(config.Auth.AccessTokenTTL).Unix(),
+		},
+	}
+	return signToken(claims)
+}
+
+// verifyToken checks the signature of the token and decodes its claims
+func verifyToken(parser *jwt.Parser, tokenString string, claims jwt.Claims) error {
+	_, err := parser.ParseWithClaims(tokenString, claims, verificationKey)
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorMalformed != 0 {
+			return fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+		}
+		return fmt.Errorf("%w: %v", ErrTokenSignature, err)
+	}
+	return nil
+}
+
+// ParseJWTClaims verifies a JWT token and returns its claims
+func ParseJWTClaims(tokenString string) (*Claims, error) {
+	parser := &jwt.Parser{
+		ValidMethods:         currentKeySet().algorithms(),
+		SkipClaimsValidation: true,
+	}
+
+	claims := &Claims{}
+	if err := verifyToken(parser, tokenString, claims); err != nil {
+		return nil, err
+	}
 
-// GenerateJWT for a given user ID
-func GenerateJWT(userID uint) (string, error) {
-	claims := jwt.MapClaims{
-		"userID": strconv.FormatUint(uint64(userID), 10), // Stores userID as a string representation of an integer
-		"exp":    time.Now().Add(time.Hour * 72).Unix(),
+	if err := validateClaims(claims, time.Now()); err != nil {
+		return nil, err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return claims, nil
+}
+
+// validateStandardClaims checks exp, nbf, iat, iss and aud, allowing for clock skew
+func validateStandardClaims(claims *jwt.StandardClaims, audience string, now time.Time) error {
+	skew := int64(config.Auth.JWTClockSkew.Seconds())
+	unixNow := now.Unix()
+
+	if claims.ExpiresAt == 0 || unixNow > claims.ExpiresAt+skew {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && unixNow < claims.NotBefore-skew {
+		return ErrTokenNotYetValid
+	}
+	if claims.IssuedAt == 0 || unixNow < claims.IssuedAt-skew {
+		return ErrTokenNotYetValid
+	}
+	if claims.Issuer != config.Auth.JWTIssuer {
+		return ErrTokenIssuer
+	}
+	if claims.Audience != audience {
+		return ErrTokenAudience
+	}
+	return nil
+}
+
+func validateClaims(claims *Claims, now time.Time) error {
+	if err := validateStandardClaims(&claims.StandardClaims, config.Auth.JWTAudience, now); err != nil {
+		return err
+	}
+	if claims.Id == "" {
+		return fmt.Errorf("%w: missing jti", ErrTokenClaims)
+	}
+	if _, err := strconv.ParseUint(claims.UserID, 10, 64); err != nil {
+		return fmt.Errorf("%w: invalid userID", ErrTokenClaims)
+	}
+	if !models.Role(claims.Role).Valid() {
+		return fmt.Errorf("%w: invalid role", ErrTokenClaims)
+	}
+	return nil
 }
 
 // ParseJWT parses a JWT token and returns the user ID
 func ParseJWT(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+	claims, err := ParseJWTClaims(tokenString)
 	if err != nil {
 		return "", err
 	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID := claims["userID"].(string)
-		return userID, nil
-	}
-	return "", err
+	return claims.UserID, nil
 }
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"Blogsite/config"
+	"Blogsite/models"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"gorm.io/gorm"
+)
+
+func TestParseJWTClaimsValidation(t *testing.T) {
+	ks, err := LoadKeySet("", "a-test-secret-that-is-at-least-32-bytes", "")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+	SetKeySet(ks)
+	config.Auth.JWTClockSkew = 30 * time.Second
+
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"userID": "7",
+			"ver":    0,
+			"role":   "author",
+			"jti":    "test-jti",
+			"iss":    config.Auth.JWTIssuer,
+			"aud":    config.Auth.JWTAudience,
+			"iat":    now.Unix(),
+			"nbf":    now.Unix(),
+			"exp":    now.Add(time.Minute).Unix(),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(jwt.MapClaims)
+		expectedErr error
+	}{
+		{name: "Valid token", modify: func(c jwt.MapClaims) {}},
+		{name: "Expired token", modify: func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Minute).Unix() }, expectedErr: ErrTokenExpired},
+		{name: "Expired within clock skew", modify: func(c jwt.MapClaims) { c["exp"] = now.Add(-10 * time.Second).Unix() }},
+		{name: "Missing expiry", modify: func(c jwt.MapClaims) { delete(c, "exp") }, expectedErr: ErrTokenExpired},
+		{name: "Not yet valid", modify: func(c jwt.MapClaims) { c["nbf"] = now.Add(time.Minute).Unix() }, expectedErr: ErrTokenNotYetValid},
+		{name: "Issued in the future", modify: func(c jwt.MapClaims) { c["iat"] = now.Add(time.Minute).Unix() }, expectedErr: ErrTokenNotYetValid},
+		{name: "Issued slightly in the future", modify: func(c jwt.MapClaims) { c["iat"] = now.Add(10 * time.Second).Unix() }},
+		{name: "Wrong issuer", modify: func(c jwt.MapClaims) { c["iss"] = "someone-else" }, expectedErr: ErrTokenIssuer},
+		{name: "Wrong audience", modify: func(c jwt.MapClaims) { c["aud"] = "another-api" }, expectedErr: ErrTokenAudience},
+		{name: "Missing userID", modify: func(c jwt.MapClaims) { delete(c, "userID") }, expectedErr: ErrTokenClaims},
+		{name: "Numeric userID", modify: func(c jwt.MapClaims) { c["userID"] = 7 }, expectedErr: ErrTokenMalformed},
+		{name: "Missing jti", modify: func(c jwt.MapClaims) { delete(c, "jti") }, expectedErr: ErrTokenClaims},
+		{name: "Unknown role", modify: func(c jwt.MapClaims) { c["role"] = "superuser" }, expectedErr: ErrTokenClaims},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := valid()
+			tc.modify(claims)
+			token, err := signToken(claims)
+			if err != nil {
+				t.Fatalf("Failed to sign token: %v", err)
+			}
+
+			_, err = ParseJWTClaims(token)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("Expected token to be valid, got %v", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+
+	t.Run("Bad signature", func(t *testing.T) {
+		token, err := signToken(valid())
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		if _, err := ParseJWTClaims(token[:len(token)-2] + "AA"); !errors.Is(err, ErrTokenSignature) {
+			t.Errorf("Expected error %v, got %v", ErrTokenSignature, err)
+		}
+	})
+}
+
+func TestActionTokens(t *testing.T) {
+	ks, err := LoadKeySet("", "a-test-secret-that-is-at-least-32-bytes", "")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+	SetKeySet(ks)
+
+	user := models.User{Model: gorm.Model{ID: 9}, Email: "verify@example.com", Role: models.RoleAuthor}
+
+	token, err := GenerateActionToken(PurposeEmailVerification, user, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate action token: %v", err)
+	}
+
+	claims, err := ParseActionToken(token, PurposeEmailVerification)
+	if err != nil {
+		t.Fatalf("Expected action token to be valid, got %v", err)
+	}
+	if claims.UserIDValue() != 9 || claims.Email != user.Email {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+
+	if _, err := ParseActionToken(token, "another-purpose"); !errors.Is(err, ErrTokenAudience) {
+		t.Errorf("Expected token for another purpose to be rejected, got %v", err)
+	}
+	if _, err := ParseJWTClaims(token); err == nil {
+		t.Errorf("Expected action token to be rejected as an access token")
+	}
+
+	accessToken, err := GenerateJWT(user)
+	if err != nil {
+		t.Fatalf("Failed to generate access token: %v", err)
+	}
+	if _, err := ParseActionToken(accessToken, PurposeEmailVerification); err == nil {
+		t.Errorf("Expected access token to be rejected as an action token")
+	}
+
+	expired, err := GenerateActionToken(PurposeEmailVerification, user, -time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate action token: %v", err)
+	}
+	if _, err := ParseActionToken(expired, PurposeEmailVerification); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected expired token to be rejected, got %v", err)
+	}
+}
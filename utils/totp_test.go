@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B test vectors for SHA1, truncated to six digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{unix: 59, expected: "287082"},
+		{unix: 1111111109, expected: "081804"},
+		{unix: 1111111111, expected: "050471"},
+		{unix: 1234567890, expected: "005924"},
+		{unix: 2000000000, expected: "279037"},
+		{unix: 20000000000, expected: "353130"},
+	}
+
+	for _, tc := range tests {
+		code, err := TOTPCode(secret, time.Unix(tc.unix, 0))
+		if err != nil {
+			t.Fatalf("Failed to compute code: %v", err)
+		}
+		if code != tc.expected {
+			t.Errorf("code at %v: got %v want %v", tc.unix, code, tc.expected)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Failed to generate secret: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	previous, _ := TOTPCode(secret, now.Add(-30*time.Second))
+	current, _ := TOTPCode(secret, now)
+	stale, _ := TOTPCode(secret, now.Add(-5*time.Minute))
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		ok       bool
+	}{
+		{name: "Current code", code: current, ok: true},
+		{name: "Previous step within skew", code: previous, ok: true},
+		{name: "Code from five minutes ago", code: stale, ok: false},
+		{name: "Replayed code", code: current, lastStep: totpStep(now), ok: false},
+		{name: "Wrong length", code: "12345", ok: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, ok := VerifyTOTP(secret, tc.code, now, tc.lastStep); ok != tc.ok {
+				t.Errorf("VerifyTOTP returned %v want %v", ok, tc.ok)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("Failed to generate recovery codes: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("Unexpected recovery code format: %v", code)
+		}
+		if seen[code] {
+			t.Errorf("Duplicate recovery code: %v", code)
+		}
+		seen[code] = true
+
+		typed := " " + code[:5] + code[6:] + " "
+		if NormalizeRecoveryCode(typed) != code {
+			t.Errorf("NormalizeRecoveryCode(%q) = %v want %v", typed, NormalizeRecoveryCode(typed), code)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+type afterCommitKey struct{}
+
+// afterCommitHooks collects the functions to run once a transaction commits
+type afterCommitHooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// Transaction runs fn in a database transaction like gorm's, then runs the
+// functions registered with AfterCommit if and only if it committed
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	hooks := &afterCommitHooks{}
+	ctx := context.WithValue(db.Statement.Context, afterCommitKey{}, hooks)
+	if err := db.WithContext(ctx).Transaction(fn); err != nil {
+		return err
+	}
+
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	for _, f := range hooks.fns {
+		f()
+	}
+	return nil
+}
+
+// AfterCommit runs f once the transaction started by Transaction that tx
+// belongs to has committed. Outside of one, tx writes are already committed
+// and f runs at once. The in-memory caches are only updated this way, so
+// other requests never cache what a rollback undoes.
+func AfterCommit(tx *gorm.DB, f func()) {
+	hooks, ok := tx.Statement.Context.Value(afterCommitKey{}).(*afterCommitHooks)
+	if !ok {
+		f()
+		return
+	}
+	hooks.mu.Lock()
+	hooks.fns = append(hooks.fns, f)
+	hooks.mu.Unlock()
+}
@@ -0,0 +1,323 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers of the supported credential keys
+const (
+	COSEAlgES256 int64 = -7
+	COSEAlgEdDSA int64 = -8
+	COSEAlgRS256 int64 = -257
+)
+
+// SupportedCOSEAlgorithms is offered to authenticators in order of preference
+var SupportedCOSEAlgorithms = []int64{COSEAlgES256, COSEAlgEdDSA, COSEAlgRS256}
+
+// Authenticator data flags
+const (
+	authDataUserPresent  byte = 0x01
+	authDataUserVerified byte = 0x04
+	authDataAttested     byte = 0x40
+	authDataExtensions   byte = 0x80
+)
+
+var ErrWebAuthn = errors.New("webauthn verification failed")
+
+func webauthnError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrWebAuthn, fmt.Sprintf(format, args...))
+}
+
+// RelyingParty identifies this server to authenticators
+type RelyingParty struct {
+	ID      string
+	Origins []string
+}
+
+// WebAuthnCredential is what the server keeps after a successful registration
+type WebAuthnCredential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+	AAGUID    []byte
+}
+
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type authenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+	AAGUID    []byte
+	CredID    []byte
+	CredKey   []byte
+}
+
+func (rp RelyingParty) checkClientData(clientDataJSON []byte, ceremony, challenge string) error {
+	var cd collectedClientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return webauthnError("invalid client data")
+	}
+	if cd.Type != ceremony {
+		return webauthnError("unexpected ceremony type %q", cd.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(challenge)) != 1 {
+		return webauthnError("challenge mismatch")
+	}
+	if cd.CrossOrigin {
+		return webauthnError("cross-origin ceremonies are not allowed")
+	}
+	for _, origin := range rp.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return webauthnError("unexpected origin %q", cd.Origin)
+}
+
+func (rp RelyingParty) checkAuthData(ad *authenticatorData) error {
+	expected := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.RPIDHash, expected[:]) {
+		return webauthnError("relying party ID mismatch")
+	}
+	if ad.Flags&authDataUserPresent == 0 {
+		return webauthnError("user was not present")
+	}
+	// A passkey stands in for the password and the second factor, so touching
+	// a stolen key is not enough; the authenticator must have checked a PIN or
+	// biometric
+	if ad.Flags&authDataUserVerified == 0 {
+		return webauthnError("user was not verified")
+	}
+	return nil
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, webauthnError("authenticator data too short")
+	}
+	ad := &authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if ad.Flags&authDataAttested != 0 {
+		if len(rest) < 18 {
+			return nil, webauthnError("attested credential data too short")
+		}
+		ad.AAGUID = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLen {
+			return nil, webauthnError("credential ID truncated")
+		}
+		ad.CredID = rest[:idLen]
+		rest = rest[idLen:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, webauthnError("invalid credential public key")
+		}
+		ad.CredKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	if ad.Flags&authDataExtensions != 0 {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, webauthnError("invalid extensions")
+		}
+		rest = rest[n:]
+	}
+	if len(rest) != 0 {
+		return nil, webauthnError("trailing authenticator data")
+	}
+	return ad, nil
+}
+
+// parseCOSEKey returns the public key and algorithm of a COSE_Key
+func parseCOSEKey(data []byte) (crypto.PublicKey, int64, error) {
+	decoded, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, 0, webauthnError("invalid COSE key")
+	}
+	m, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, webauthnError("COSE key is not a map")
+	}
+
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	switch {
+	case kty == 2 && alg == COSEAlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, webauthnError("invalid EC2 key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, webauthnError("EC2 point is not on the curve")
+		}
+		return pub, alg, nil
+	case kty == 1 && alg == COSEAlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, webauthnError("invalid OKP key")
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case kty == 3 && alg == COSEAlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, webauthnError("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, alg, nil
+	}
+	return nil, 0, webauthnError("unsupported key type %d with algorithm %d", kty, alg)
+}
+
+func verifyCOSESignature(pub crypto.PublicKey, alg int64, message, sig []byte) error {
+	var ok bool
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		ok = alg == COSEAlgES256 && ecdsa.VerifyASN1(k, digest[:], sig)
+	case ed25519.PublicKey:
+		ok = alg == COSEAlgEdDSA && ed25519.Verify(k, message, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+		ok = alg == COSEAlgRS256 && rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !ok {
+		return webauthnError("invalid signature")
+	}
+	return nil
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create() and
+// returns the new credential. Attestation is not required: "none" is accepted,
+// and "packed" only in its self-attestation form.
+func (rp RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*WebAuthnCredential, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, webauthnError("invalid attestation object")
+	}
+	att, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, webauthnError("attestation object is not a map")
+	}
+	format, _ := att["fmt"].(string)
+	rawAuthData, _ := att["authData"].([]byte)
+	attStmt, _ := att["attStmt"].(map[interface{}]interface{})
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthData(ad); err != nil {
+		return nil, err
+	}
+	if ad.Flags&authDataAttested == 0 || len(ad.CredID) == 0 {
+		return nil, webauthnError("no attested credential data")
+	}
+
+	pub, alg, err := parseCOSEKey(ad.CredKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "none":
+		if len(attStmt) != 0 {
+			return nil, webauthnError("unexpected attestation statement")
+		}
+	case "packed":
+		if _, hasX5C := attStmt["x5c"]; hasX5C {
+			return nil, webauthnError("certificate attestation is not supported")
+		}
+		stmtAlg, _ := attStmt["alg"].(int64)
+		sig, _ := attStmt["sig"].([]byte)
+		if stmtAlg != alg {
+			return nil, webauthnError("attestation algorithm mismatch")
+		}
+		clientDataHash := sha256.Sum256(clientDataJSON)
+		if err := verifyCOSESignature(pub, alg, append(append([]byte(nil), rawAuthData...), clientDataHash[:]...), sig); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, webauthnError("unsupported attestation format %q", format)
+	}
+
+	return &WebAuthnCredential{
+		ID:        append([]byte(nil), ad.CredID...),
+		PublicKey: append([]byte(nil), ad.CredKey...),
+		SignCount: ad.SignCount,
+		AAGUID:    append([]byte(nil), ad.AAGUID...),
+	}, nil
+}
+
+// VerifyAssertion checks the response to navigator.credentials.get() against a
+// stored credential and returns the authenticator's new signature counter.
+// A counter that does not increase indicates a cloned authenticator.
+func (rp RelyingParty) VerifyAssertion(challenge string, cred WebAuthnCredential, clientDataJSON, rawAuthData, signature []byte) (uint32, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.checkAuthData(ad); err != nil {
+		return 0, err
+	}
+
+	pub, alg, err := parseCOSEKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err := verifyCOSESignature(pub, alg, append(append([]byte(nil), rawAuthData...), clientDataHash[:]...), signature); err != nil {
+		return 0, err
+	}
+
+	if (ad.SignCount != 0 || cred.SignCount != 0) && ad.SignCount <= cred.SignCount {
+		return 0, webauthnError("signature counter did not increase")
+	}
+	return ad.SignCount, nil
+}
+
+// DecodeBase64URL accepts base64url with or without padding, as browsers differ
+func DecodeBase64URL(s string) ([]byte, error) {
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
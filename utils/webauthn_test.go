@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+)
+
+// cborEncode encodes the subset of CBOR produced by authenticators
+func cborEncode(v interface{}) []byte {
+	var buf bytes.Buffer
+	head := func(major byte, n uint64) {
+		switch {
+		case n < 24:
+			buf.WriteByte(major<<5 | byte(n))
+		case n < 1<<8:
+			buf.WriteByte(major<<5 | 24)
+			buf.WriteByte(byte(n))
+		case n < 1<<16:
+			buf.WriteByte(major<<5 | 25)
+			binary.Write(&buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(major<<5 | 26)
+			binary.Write(&buf, binary.BigEndian, uint32(n))
+		}
+	}
+
+	switch x := v.(type) {
+	case int:
+		if x >= 0 {
+			head(0, uint64(x))
+		} else {
+			head(1, uint64(-1-x))
+		}
+	case int64:
+		return cborEncode(int(x))
+	case []byte:
+		head(2, uint64(len(x)))
+		buf.Write(x)
+	case string:
+		head(3, uint64(len(x)))
+		buf.WriteString(x)
+	case map[interface{}]interface{}:
+		// Deterministic key order keeps the encoding stable between runs
+		keys := make([][]byte, 0, len(x))
+		values := make(map[string][]byte, len(x))
+		for k, v := range x {
+			ek := cborEncode(k)
+			keys = append(keys, ek)
+			values[string(ek)] = cborEncode(v)
+		}
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+		head(5, uint64(len(x)))
+		for _, k := range keys {
+			buf.Write(k)
+			buf.Write(values[string(k)])
+		}
+	default:
+		panic("cborEncode: unsupported type")
+	}
+	return buf.Bytes()
+}
+
+// softAuthenticator is a software stand-in for a security key or platform passkey
+type softAuthenticator struct {
+	rpID      string
+	origin    string
+	credID    []byte
+	signer    crypto.Signer
+	signCount uint32
+}
+
+func newSoftAuthenticator(t *testing.T, alg int64) *softAuthenticator {
+	a := &softAuthenticator{rpID: "localhost", origin: "http://localhost:8080", credID: make([]byte, 16)}
+	rand.Read(a.credID)
+
+	var err error
+	switch alg {
+	case COSEAlgES256:
+		a.signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case COSEAlgEdDSA:
+		_, a.signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return a
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	switch pub := a.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		return cborEncode(map[interface{}]interface{}{1: 2, 3: int(COSEAlgES256), -1: 1, -2: x, -3: y})
+	case ed25519.PublicKey:
+		return cborEncode(map[interface{}]interface{}{1: 1, 3: int(COSEAlgEdDSA), -1: 6, -2: []byte(pub)})
+	}
+	panic("unsupported key")
+}
+
+func (a *softAuthenticator) clientData(ceremony, challenge string) []byte {
+	b, _ := json.Marshal(map[string]interface{}{"type": ceremony, "challenge": challenge, "origin": a.origin})
+	return b
+}
+
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	flags := authDataUserPresent | authDataUserVerified
+	if attested {
+		flags |= authDataAttested
+	}
+
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // zero AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credID)))
+		data = append(data, a.credID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func (a *softAuthenticator) sign(authData, clientDataJSON []byte) []byte {
+	hash := sha256.Sum256(clientDataJSON)
+	message := append(append([]byte(nil), authData...), hash[:]...)
+	if _, ok := a.signer.(ed25519.PrivateKey); ok {
+		sig, _ := a.signer.Sign(rand.Reader, message, crypto.Hash(0))
+		return sig
+	}
+	digest := sha256.Sum256(message)
+	sig, _ := a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	return sig
+}
+
+// create answers navigator.credentials.create()
+func (a *softAuthenticator) create(challenge, format string) (clientDataJSON, attestationObject []byte) {
+	clientDataJSON = a.clientData("webauthn.create", challenge)
+	authData := a.authData(true)
+
+	attStmt := map[interface{}]interface{}{}
+	if format == "packed" {
+		alg := COSEAlgES256
+		if _, ok := a.signer.(ed25519.PrivateKey); ok {
+			alg = COSEAlgEdDSA
+		}
+		attStmt["alg"] = int(alg)
+		attStmt["sig"] = a.sign(authData, clientDataJSON)
+	}
+	return clientDataJSON, cborEncode(map[interface{}]interface{}{"fmt": format, "authData": authData, "attStmt": attStmt})
+}
+
+// get answers navigator.credentials.get()
+func (a *softAuthenticator) get(challenge string) (clientDataJSON, authData, signature []byte) {
+	a.signCount++
+	clientDataJSON = a.clientData("webauthn.get", challenge)
+	authData = a.authData(false)
+	return clientDataJSON, authData, a.sign(authData, clientDataJSON)
+}
+
+func TestWebAuthnCeremonies(t *testing.T) {
+	rp := RelyingParty{ID: "localhost", Origins: []string{"http://localhost:8080"}}
+
+	for _, tc := range []struct {
+		name   string
+		alg    int64
+		format string
+	}{
+		{name: "ES256 none", alg: COSEAlgES256, format: "none"},
+		{name: "ES256 packed", alg: COSEAlgES256, format: "packed"},
+		{name: "EdDSA none", alg: COSEAlgEdDSA, format: "none"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			auth := newSoftAuthenticator(t, tc.alg)
+
+			clientData, attestation := auth.create("register-challenge", tc.format)
+			cred, err := rp.VerifyRegistration("register-challenge", clientData, attestation)
+			if err != nil {
+				t.Fatalf("Registration failed: %v", err)
+			}
+			if !bytes.Equal(cred.ID, auth.credID) {
+				t.Errorf("credential ID: got %x want %x", cred.ID, auth.credID)
+			}
+
+			clientData, authData, sig := auth.get("login-challenge")
+			count, err := rp.VerifyAssertion("login-challenge", *cred, clientData, authData, sig)
+			if err != nil {
+				t.Fatalf("Assertion failed: %v", err)
+			}
+			if count != auth.signCount {
+				t.Errorf("sign count: got %d want %d", count, auth.signCount)
+			}
+		})
+	}
+}
+
+func TestWebAuthnRejectsInvalidResponses(t *testing.T) {
+	rp := RelyingParty{ID: "localhost", Origins: []string{"http://localhost:8080"}}
+
+	auth := newSoftAuthenticator(t, COSEAlgES256)
+	clientData, attestation := auth.create("challenge", "none")
+	cred, err := rp.VerifyRegistration("challenge", clientData, attestation)
+	if err != nil {
+		t.Fatalf("Registration failed: %v", err)
+	}
+
+	t.Run("registration with wrong challenge", func(t *testing.T) {
+		clientData, attestation := auth.create("other", "none")
+		if _, err := rp.VerifyRegistration("challenge", clientData, attestation); !errors.Is(err, ErrWebAuthn) {
+			t.Errorf("expected ErrWebAuthn, got %v", err)
+		}
+	})
+
+	t.Run("registration with unsupported attestation", func(t *testing.T) {
+		clientData, attestation := auth.create("challenge", "fido-u2f")
+		if _, err := rp.VerifyRegistration("challenge", clientData, attestation); !errors.Is(err, ErrWebAuthn) {
+			t.Errorf("expected ErrWebAuthn, got %v", err)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		tamper func(a *softAuthenticator, clientData, authData, sig []byte) ([]byte, []byte, []byte)
+	}{
+		{
+			name: "wrong origin",
+			tamper: func(a *softAuthenticator, clientData, authData, sig []byte) ([]byte, []byte, []byte) {
+				a.origin = "https://evil.example"
+				clientData, authData, sig = a.get("challenge")
+				a.origin = "http://localhost:8080"
+				return clientData, authData, sig
+			},
+		},
+		{
+			name: "wrong relying party",
+			tamper: func(a *softAuthenticator, clientData, authData, sig []byte) ([]byte, []byte, []byte) {
+				a.rpID = "evil.example"
+				clientData, authData, sig = a.get("challenge")
+				a.rpID = "localhost"
+				return clientData, authData, sig
+			},
+		},
+		{
+			name: "wrong ceremony",
+			tamper: func(a *softAuthenticator, clientData, authData, sig []byte) ([]byte, []byte, []byte) {
+				clientData = a.clientData("webauthn.create", "challenge")
+				return clientData, authData, a.sign(authData, clientData)
+			},
+		},
+		{
+			name: "bad signature",
+			tamper: func(a *softAuthenticator, clientData, authData, sig []byte) ([]byte, []byte, []byte) {
+				authData[len(authData)-1] ^= 0xff
+				return clientData, authData, sig
+			},
+		},
+		{
+			name: "user not present",
+			tamper: func(a *softAuthenticator, clientData, authData, sig []byte) ([]byte, []byte, []byte) {
+				authData[32] &^= authDataUserPresent
+				return clientData, authData, a.sign(authData, clientData)
+			},
+		},
+		{
+			name: "user not verified",
+			tamper: func(a *softAuthenticator, clientData, authData, sig []byte) ([]byte, []byte, []byte) {
+				authData[32] &^= authDataUserVerified
+				return clientData, authData, a.sign(authData, clientData)
+			},
+		},
+		{
+			name: "replayed counter",
+			tamper: func(a *softAuthenticator, clientData, authData, sig []byte) ([]byte, []byte, []byte) {
+				a.signCount = cred.SignCount - 1
+				return a.get("challenge")
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clientData, authData, sig := auth.get("challenge")
+			cred.SignCount = auth.signCount - 1
+			clientData, authData, sig = tc.tamper(auth, clientData, authData, sig)
+			if _, err := rp.VerifyAssertion("challenge", *cred, clientData, authData, sig); !errors.Is(err, ErrWebAuthn) {
+				t.Errorf("expected ErrWebAuthn, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeBase64URL(t *testing.T) {
+	want := []byte{0xfb, 0xff, 0x01}
+	for _, s := range []string{base64.RawURLEncoding.EncodeToString(want), base64.URLEncoding.EncodeToString(want)} {
+		got, err := DecodeBase64URL(s)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("DecodeBase64URL(%q) = %x, %v", s, got, err)
+		}
+	}
+}